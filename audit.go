@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+)
+
+// 审计日志表的默认表名
+const defaultAuditTable = "mcp_audit_log"
+
+// 单条审计记录的大小限制：参数按JSON序列化后的字节数，SQL语句条数和每条的长度
+const (
+	maxAuditArgumentBytes = 16 << 10
+	maxAuditValueBytes    = 1 << 10
+	maxAuditStatements    = 20
+	maxAuditSQLBytes      = 2 << 10
+	maxAuditErrorBytes    = 2 << 10
+)
+
+// 写入审计日志表的最长等待时间
+const auditWriteTimeout = 5 * time.Second
+
+// audit_query 默认和最多返回的记录数
+const (
+	defaultAuditQueryLimit = 50
+	maxAuditQueryLimit     = 500
+)
+
+// 工具调用的结果
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+	outcomeDenied  = "denied" // 因权限不足被拒绝
+)
+
+// 参数名匹配时整体隐藏其值
+var sensitiveArgumentPattern = regexp.MustCompile(`(?i)password|passwd|secret|token|api_?key|authorization|credential`)
+
+// 简单格式条件中字段名匹配 sensitiveArgumentPattern 的比较，如 password='x'；第二组为要隐藏的值
+var sensitiveConditionPattern = regexp.MustCompile(`(?i)([\w.]*(?:password|passwd|secret|token|api_?key|authorization|credential)[\w.]*\s*(?:>=|<=|!=|<>|=|>|<|\s+not\s+like\s+|\s+like\s+)\s*)('[^']*'|"[^"]*"|[^,]*)`)
+
+// 审计日志，未启用时为nil
+var auditLog *AuditLog
+
+// AuditConfig 审计日志配置；file 和 connection 都为空时不记录
+type AuditConfig struct {
+	File       string `json:"file" yaml:"file" toml:"file"`                   // 追加写入的JSON Lines文件
+	Connection string `json:"connection" yaml:"connection" toml:"connection"` // 同时写入该连接中的表
+	Table      string `json:"table" yaml:"table" toml:"table"`                // 表名，默认 mcp_audit_log
+}
+
+// Enabled 是否记录审计日志
+func (c AuditConfig) Enabled() bool {
+	return c.File != "" || c.Connection != ""
+}
+
+func (c AuditConfig) validate(connections map[string]DatabaseConfig) error {
+	var errs []error
+	if c.Connection != "" {
+		if config, ok := connections[c.Connection]; !ok {
+			errs = append(errs, fmt.Errorf("audit.connection: 连接 %s 不存在", c.Connection))
+		} else if config.ReadOnly {
+			errs = append(errs, fmt.Errorf("audit.connection: 连接 %s 为只读，无法写入审计日志", c.Connection))
+		}
+	}
+	if c.Table != "" && !identifierPattern.MatchString(c.Table) {
+		errs = append(errs, fmt.Errorf("audit.table: 无效的表名 %q", c.Table))
+	}
+	return errors.Join(errs...)
+}
+
+// AuditEntry 一次工具调用的审计记录
+type AuditEntry struct {
+	Timestamp    time.Time       `json:"timestamp" jsonschema:"description=调用开始时间(UTC)"`
+	Client       string          `json:"client,omitempty" jsonschema:"description=认证凭据名称，未启用认证时为空"`
+	Role         string          `json:"role,omitempty" jsonschema:"description=凭据的角色"`
+	Session      string          `json:"session,omitempty" jsonschema:"description=MCP会话ID"`
+	ClientName   string          `json:"client_name,omitempty" jsonschema:"description=客户端在初始化时声明的名称和版本"`
+	Tool         string          `json:"tool"`
+	Arguments    json.RawMessage `json:"arguments" jsonschema:"description=调用参数，密码、token等敏感值已隐藏"`
+	SQL          []string        `json:"sql,omitempty" jsonschema:"description=执行的SQL(参数以占位符表示)，最多记录前20条"`
+	SQLCount     int             `json:"sql_count,omitempty" jsonschema:"description=执行的SQL总条数"`
+	RowsAffected *int64          `json:"rows_affected,omitempty" jsonschema:"description=提交的写操作影响的记录数"`
+	DurationMs   int64           `json:"duration_ms"`
+	Outcome      string          `json:"outcome" jsonschema:"enum=success,enum=error,enum=denied"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// auditRecord 审计日志表的一行
+type auditRecord struct {
+	ID           uint      `gorm:"primaryKey"`
+	Timestamp    time.Time `gorm:"index;not null"`
+	Client       string    `gorm:"size:100;index"`
+	Role         string    `gorm:"size:100"`
+	Session      string    `gorm:"size:100"`
+	ClientName   string    `gorm:"size:200"`
+	Tool         string    `gorm:"size:100;index"`
+	Arguments    string    `gorm:"type:text"`
+	Statements   string    `gorm:"type:text"` // SQL列表的JSON
+	SQLCount     int
+	RowsAffected *int64
+	DurationMs   int64
+	Outcome      string `gorm:"size:20;index"`
+	Error        string `gorm:"type:text"`
+}
+
+// AuditLog 只追加的审计日志，写入JSON Lines文件和/或数据库表
+type AuditLog struct {
+	mu         sync.Mutex // 保证每条记录在文件中占完整的一行
+	file       *os.File
+	path       string
+	connection string
+	table      string
+
+	// 首次写入或查询表时创建表；数据库写入本身不加锁，避免一次慢写入阻塞所有工具调用
+	migrateMu sync.Mutex
+	migrated  bool
+}
+
+// 打开审计日志，未启用时返回nil
+func openAuditLog(config AuditConfig) (*AuditLog, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+	audit := &AuditLog{path: config.File, connection: config.Connection, table: config.Table}
+	if audit.table == "" {
+		audit.table = defaultAuditTable
+	}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("打开审计日志文件失败: %v", err)
+		}
+		audit.file = file
+	}
+	return audit, nil
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// 写入一条记录；写入失败只记录日志，不影响工具调用的结果
+func (a *AuditLog) write(entry *AuditEntry) {
+	if a.file != nil {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			a.mu.Lock()
+			_, err = a.file.Write(append(data, '\n'))
+			a.mu.Unlock()
+		}
+		if err != nil {
+			log.Printf("写入审计日志文件失败: %v", err)
+		}
+	}
+	if a.connection != "" {
+		if err := a.insert(entry); err != nil {
+			log.Printf("写入审计日志表 %s.%s 失败: %v", a.connection, a.table, err)
+		}
+	}
+}
+
+// 写入审计日志表，首次写入时创建表
+func (a *AuditLog) insert(entry *AuditEntry) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+
+	record, err := entry.record()
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Table(a.table).Create(record).Error
+}
+
+func (a *AuditLog) db() (*gorm.DB, error) {
+	db, err := dbManager.GetConnection(a.connection)
+	if err != nil {
+		return nil, err
+	}
+	a.migrateMu.Lock()
+	defer a.migrateMu.Unlock()
+	if !a.migrated {
+		ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+		defer cancel()
+		if err := db.WithContext(ctx).Table(a.table).AutoMigrate(&auditRecord{}); err != nil {
+			return nil, fmt.Errorf("创建审计日志表失败: %v", err)
+		}
+		a.migrated = true
+	}
+	return db, nil
+}
+
+// 审计日志表所在的连接和表名，未写入表时返回空字符串
+func (a *AuditLog) tableLocation() (string, string) {
+	if a == nil {
+		return "", ""
+	}
+	return a.connection, a.table
+}
+
+// 审计日志表只允许追加，拒绝通过工具修改
+func checkAuditTableWrite(connection, operation, table string) error {
+	auditConnection, auditTable := auditLog.tableLocation()
+	if auditConnection == "" || connection != auditConnection || !strings.EqualFold(table, auditTable) {
+		return nil
+	}
+	switch strings.ToLower(operation) {
+	case "select", "count":
+		return nil
+	}
+	return fmt.Errorf("拒绝执行: 审计日志表 %s 只能由服务器追加，不允许 %s", auditTable, operation)
+}
+
+func (e *AuditEntry) record() (*auditRecord, error) {
+	statements, err := json.Marshal(e.SQL)
+	if err != nil {
+		return nil, err
+	}
+	return &auditRecord{
+		Timestamp:    e.Timestamp,
+		Client:       e.Client,
+		Role:         e.Role,
+		Session:      e.Session,
+		ClientName:   e.ClientName,
+		Tool:         e.Tool,
+		Arguments:    string(e.Arguments),
+		Statements:   string(statements),
+		SQLCount:     e.SQLCount,
+		RowsAffected: e.RowsAffected,
+		DurationMs:   e.DurationMs,
+		Outcome:      e.Outcome,
+		Error:        e.Error,
+	}, nil
+}
+
+func (r *auditRecord) entry() AuditEntry {
+	entry := AuditEntry{
+		Timestamp:    r.Timestamp.UTC(),
+		Client:       r.Client,
+		Role:         r.Role,
+		Session:      r.Session,
+		ClientName:   r.ClientName,
+		Tool:         r.Tool,
+		Arguments:    json.RawMessage(r.Arguments),
+		SQLCount:     r.SQLCount,
+		RowsAffected: r.RowsAffected,
+		DurationMs:   r.DurationMs,
+		Outcome:      r.Outcome,
+		Error:        r.Error,
+	}
+	if !json.Valid(entry.Arguments) {
+		entry.Arguments = json.RawMessage("{}")
+	}
+	json.Unmarshal([]byte(r.Statements), &entry.SQL)
+	return entry
+}
+
+// auditRecorder 收集一次工具调用中执行的SQL，通过上下文传给gorm回调
+type auditRecorder struct {
+	mu         sync.Mutex
+	statements []string
+	count      int
+	denied     bool
+}
+
+type auditRecorderKey struct{}
+
+func auditRecorderFromContext(ctx context.Context) (*auditRecorder, bool) {
+	recorder, ok := ctx.Value(auditRecorderKey{}).(*auditRecorder)
+	return recorder, ok
+}
+
+// 在连接上注册gorm回调，记录每条实际执行的SQL
+func registerAuditCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().After("gorm:create").Register("audit:create", recordStatement),
+		callback.Query().After("gorm:query").Register("audit:query", recordStatement),
+		callback.Update().After("gorm:update").Register("audit:update", recordStatement),
+		callback.Delete().After("gorm:delete").Register("audit:delete", recordStatement),
+		callback.Row().After("gorm:row").Register("audit:row", recordStatement),
+		callback.Raw().After("gorm:raw").Register("audit:raw", recordStatement),
+	)
+}
+
+func recordStatement(db *gorm.DB) {
+	if db.DryRun || db.Statement.Context == nil {
+		return
+	}
+	recorder, ok := auditRecorderFromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	sql := db.Statement.SQL.String()
+	if sql == "" {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.count++
+	if len(recorder.statements) < maxAuditStatements {
+		recorder.statements = append(recorder.statements, truncateText(sql, maxAuditSQLBytes))
+	}
+}
+
+// 权限检查失败时调用，使审计记录的结果为 denied
+func auditDenied(ctx context.Context, err error) error {
+	if ctx == nil {
+		return err
+	}
+	if recorder, ok := auditRecorderFromContext(ctx); ok {
+		recorder.mu.Lock()
+		recorder.denied = true
+		recorder.mu.Unlock()
+	}
+	return err
+}
+
+// 工具调用中间件：记录每次调用的客户端、参数、SQL、耗时和结果；应作为最外层的中间件
+func auditToolMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if auditLog == nil {
+			return next(ctx, request)
+		}
+
+		recorder := &auditRecorder{}
+		start := time.Now()
+		result, err := next(context.WithValue(ctx, auditRecorderKey{}, recorder), request)
+
+		entry := &AuditEntry{
+			Timestamp:  start.UTC(),
+			Tool:       request.Params.Name,
+			Arguments:  auditArguments(request.GetArguments()),
+			DurationMs: time.Since(start).Milliseconds(),
+			Outcome:    outcomeSuccess,
+		}
+		if principal, ok := principalFromContext(ctx); ok {
+			entry.Client = principal.Name
+			entry.Role = principal.Role
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			entry.Session = session.SessionID()
+			if withInfo, ok := session.(server.SessionWithClientInfo); ok {
+				info := withInfo.GetClientInfo()
+				entry.ClientName = strings.TrimSpace(info.Name + " " + info.Version)
+			}
+		}
+
+		recorder.mu.Lock()
+		entry.SQL = recorder.statements
+		entry.SQLCount = recorder.count
+		denied := recorder.denied
+		recorder.mu.Unlock()
+
+		switch {
+		case err != nil:
+			entry.Outcome = outcomeError
+			entry.Error = truncateText(err.Error(), maxAuditErrorBytes)
+		case result != nil && result.IsError:
+			entry.Outcome = outcomeError
+			if denied {
+				entry.Outcome = outcomeDenied
+			}
+			entry.Error = truncateText(resultText(result), maxAuditErrorBytes)
+		}
+		if result != nil && !result.IsError {
+			entry.RowsAffected = committedRows(result)
+		}
+
+		auditLog.write(entry)
+		return result, err
+	}
+}
+
+// 从结构化结果中取出已提交的写操作影响的记录数
+func committedRows(result *mcp.CallToolResult) *int64 {
+	switch content := result.StructuredContent.(type) {
+	case *QueryResult:
+		if content.DryRun {
+			return nil
+		}
+		return content.RowsAffected
+	case *TransactionResult:
+		if !content.Committed {
+			return nil
+		}
+		var total int64
+		var written bool
+		for _, step := range content.Steps {
+			if step.Result != nil && step.Result.RowsAffected != nil {
+				total += *step.Result.RowsAffected
+				written = true
+			}
+		}
+		if written {
+			return &total
+		}
+	}
+	return nil
+}
+
+// 工具结果中的第一段文本
+func resultText(result *mcp.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// 隐藏敏感参数后序列化；超过大小限制时把较大的参数值替换为省略说明
+func auditArguments(arguments map[string]interface{}) json.RawMessage {
+	redacted, _ := redactArgument("", arguments).(map[string]interface{})
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	if len(data) <= maxAuditArgumentBytes {
+		return data
+	}
+
+	for key, value := range redacted {
+		encoded, err := json.Marshal(value)
+		if err != nil || len(encoded) > maxAuditValueBytes {
+			redacted[key] = fmt.Sprintf("<已省略 %d 字节>", len(encoded))
+		}
+	}
+	if data, err = json.Marshal(redacted); err != nil || len(data) > maxAuditArgumentBytes {
+		return json.RawMessage(fmt.Sprintf(`{"_omitted":"参数共 %d 字节，超过审计记录的上限"}`, len(data)))
+	}
+	return data
+}
+
+// 递归隐藏敏感参数：密码、token等整体替换，DSN只隐藏其中的密码；
+// fields、where_conditions 等JSON字符串参数解析后同样处理，条件树中 field 为敏感列时隐藏其 value
+func redactArgument(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			redacted[k] = redactArgument(k, item)
+		}
+		if field, ok := v["field"].(string); ok && sensitiveArgumentPattern.MatchString(field) && v["value"] != nil {
+			redacted["value"] = redactedPassword
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactArgument(key, item)
+		}
+		return redacted
+	case string:
+		switch {
+		case strings.EqualFold(key, "dsn"):
+			return redactDSN(v)
+		case sensitiveArgumentPattern.MatchString(key) && v != "":
+			return redactedPassword
+		}
+		return redactEmbedded(key, v)
+	}
+	return value
+}
+
+// 隐藏字符串参数中嵌入的敏感值：JSON对象或数组按参数处理，条件参数的简单格式按字段名处理；
+// 没有需要隐藏的内容时原样返回
+func redactEmbedded(key, value string) string {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		var parsed interface{}
+		if decoder.Decode(&parsed) == nil {
+			redacted := redactArgument(key, parsed)
+			if reflect.DeepEqual(parsed, redacted) {
+				return value
+			}
+			if data, err := json.Marshal(redacted); err == nil {
+				return string(data)
+			}
+			return redactedPassword
+		}
+	}
+	if strings.EqualFold(key, "where_conditions") || strings.EqualFold(key, "having") {
+		return sensitiveConditionPattern.ReplaceAllString(value, "${1}"+redactedPassword)
+	}
+	return value
+}
+
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	// 按字符截断，避免截出半个UTF-8字符
+	for limit > 0 && !utf8RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit] + "..."
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// 注册审计日志查询工具
+func registerAuditTools(s *server.MCPServer) {
+	auditTool := mcp.NewTool("audit_query",
+		mcp.WithDescription("查询审计日志：谁在什么时候调用了哪个工具、执行了哪些SQL及结果，按时间倒序返回"),
+		mcp.WithString("client",
+			mcp.Description("凭据名称"),
+		),
+		mcp.WithString("tool",
+			mcp.Description("工具名称，如 database_query"),
+		),
+		mcp.WithString("outcome",
+			mcp.Description("调用结果"),
+			mcp.Enum(outcomeSuccess, outcomeError, outcomeDenied),
+		),
+		mcp.WithString("since",
+			mcp.Description("起始时间(含)，RFC3339格式，如 2024-05-01T00:00:00Z"),
+		),
+		mcp.WithString("until",
+			mcp.Description("截止时间(不含)，RFC3339格式"),
+		),
+		mcp.WithString("contains",
+			mcp.Description("在参数、SQL和错误信息中搜索的文本"),
+		),
+		mcp.WithNumber("limit",
+			mcp.DefaultNumber(defaultAuditQueryLimit),
+			mcp.Description(fmt.Sprintf("最多返回的记录数，最大%d", maxAuditQueryLimit)),
+		),
+		mcp.WithOutputSchema[AuditQueryResult](),
+	)
+	addTool(s, auditTool, handleAuditQuery)
+}
+
+// AuditQueryResult audit_query 的结构化结果
+type AuditQueryResult struct {
+	Source    string       `json:"source" jsonschema:"description=查询的来源：审计日志表或文件"`
+	Entries   []AuditEntry `json:"entries" jsonschema:"description=匹配的记录，按时间倒序"`
+	Count     int          `json:"count"`
+	Truncated bool         `json:"truncated" jsonschema:"description=是否还有更早的匹配记录"`
+}
+
+// auditFilter audit_query 的查询条件
+type auditFilter struct {
+	client, tool, outcome string
+	since, until          time.Time
+	contains              string
+	limit                 int
+}
+
+func (f *auditFilter) match(entry *AuditEntry) bool {
+	switch {
+	case f.client != "" && entry.Client != f.client,
+		f.tool != "" && entry.Tool != f.tool,
+		f.outcome != "" && entry.Outcome != f.outcome,
+		!f.since.IsZero() && entry.Timestamp.Before(f.since),
+		!f.until.IsZero() && !entry.Timestamp.Before(f.until):
+		return false
+	}
+	if f.contains == "" {
+		return true
+	}
+	return strings.Contains(string(entry.Arguments), f.contains) ||
+		slices.ContainsFunc(entry.SQL, func(sql string) bool { return strings.Contains(sql, f.contains) }) ||
+		strings.Contains(entry.Error, f.contains)
+}
+
+func handleAuditQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if auditLog == nil {
+		return mcp.NewToolResultError("审计日志未启用，请在配置文件的 audit 段中设置 file 或 connection"), nil
+	}
+
+	filter := &auditFilter{
+		client:   request.GetString("client", ""),
+		tool:     request.GetString("tool", ""),
+		outcome:  request.GetString("outcome", ""),
+		contains: request.GetString("contains", ""),
+		limit:    request.GetInt("limit", defaultAuditQueryLimit),
+	}
+	if filter.limit <= 0 || filter.limit > maxAuditQueryLimit {
+		return mcp.NewToolResultError(fmt.Sprintf("limit 必须在 1 到 %d 之间", maxAuditQueryLimit)), nil
+	}
+	for _, arg := range []struct {
+		name   string
+		target *time.Time
+	}{{"since", &filter.since}, {"until", &filter.until}} {
+		value := request.GetString(arg.name, "")
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("%s 必须是RFC3339格式的时间，如 2024-05-01T00:00:00Z", arg.name)), nil
+		}
+		*arg.target = t
+	}
+
+	var result *AuditQueryResult
+	var err error
+	if auditLog.connection != "" {
+		result, err = auditLog.queryTable(ctx, filter)
+	} else {
+		result, err = auditLog.queryFile(filter)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result.Count = len(result.Entries)
+
+	jsonData, err := json.MarshalIndent(result.Entries, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	text := fmt.Sprintf("找到 %d 条审计记录(来源: %s)", result.Count, result.Source)
+	if result.Truncated {
+		text += "，还有更早的记录，可缩小时间范围或增大limit"
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("%s:\n%s", text, jsonData)), nil
+}
+
+// 在审计日志表中查询
+func (a *AuditLog) queryTable(ctx context.Context, filter *auditFilter) (*AuditQueryResult, error) {
+	db, err := a.db()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.WithContext(ctx).Table(a.table)
+	if filter.client != "" {
+		query = query.Where("client = ?", filter.client)
+	}
+	if filter.tool != "" {
+		query = query.Where("tool = ?", filter.tool)
+	}
+	if filter.outcome != "" {
+		query = query.Where("outcome = ?", filter.outcome)
+	}
+	if !filter.since.IsZero() {
+		query = query.Where("timestamp >= ?", filter.since)
+	}
+	if !filter.until.IsZero() {
+		query = query.Where("timestamp < ?", filter.until)
+	}
+	if filter.contains != "" {
+		pattern := "%" + escapeLike(filter.contains) + "%"
+		query = query.Where("arguments LIKE ? ESCAPE '!' OR statements LIKE ? ESCAPE '!' OR error LIKE ? ESCAPE '!'", pattern, pattern, pattern)
+	}
+
+	var records []auditRecord
+	if err := query.Order("timestamp DESC").Order("id DESC").Limit(filter.limit + 1).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询审计日志表失败: %v", err)
+	}
+
+	result := &AuditQueryResult{Source: fmt.Sprintf("table %s.%s", a.connection, a.table), Entries: []AuditEntry{}}
+	if len(records) > filter.limit {
+		records = records[:filter.limit]
+		result.Truncated = true
+	}
+	for i := range records {
+		result.Entries = append(result.Entries, records[i].entry())
+	}
+	return result, nil
+}
+
+// 在JSON Lines文件中查询，保留最新的 limit 条匹配记录
+func (a *AuditLog) queryFile(filter *auditFilter) (*AuditQueryResult, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志文件失败: %v", err)
+	}
+	defer file.Close()
+
+	result := &AuditQueryResult{Source: "file " + a.path, Entries: []AuditEntry{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !filter.match(&entry) {
+			continue
+		}
+		result.Entries = append(result.Entries, entry)
+		if len(result.Entries) > filter.limit {
+			result.Entries = result.Entries[1:]
+			result.Truncated = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取审计日志文件失败: %v", err)
+	}
+	slices.Reverse(result.Entries)
+	return result, nil
+}
+
+// 转义LIKE中的通配符，配合 ESCAPE '!' 使用
+func escapeLike(text string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(text)
+}
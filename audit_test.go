@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAuditArgumentsRedaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{
+			name:      "sensitive keys",
+			arguments: map[string]interface{}{"password": "p", "api_key": "k", "name": "x", "token": ""},
+			want:      map[string]interface{}{"password": "******", "api_key": "******", "name": "x", "token": ""},
+		},
+		{
+			name:      "dsn keeps everything but the password",
+			arguments: map[string]interface{}{"dsn": "reader:s3cret@tcp(db:3306)/app"},
+			want:      map[string]interface{}{"dsn": "reader:******@tcp(db:3306)/app"},
+		},
+		{
+			name:      "json string fields",
+			arguments: map[string]interface{}{"fields": `{"name":"a","password":"s3cret","id":12345678901234567890}`},
+			want:      map[string]interface{}{"fields": `{"id":12345678901234567890,"name":"a","password":"******"}`},
+		},
+		{
+			name:      "json string without secrets is unchanged",
+			arguments: map[string]interface{}{"fields": `{ "name": "a" }`},
+			want:      map[string]interface{}{"fields": `{ "name": "a" }`},
+		},
+		{
+			name:      "condition tree on a sensitive column",
+			arguments: map[string]interface{}{"where_conditions": `{"and":[{"field":"users.password","op":"=","value":"s3cret"},{"field":"id","op":"=","value":1}]}`},
+			want:      map[string]interface{}{"where_conditions": `{"and":[{"field":"users.password","op":"=","value":"******"},{"field":"id","op":"=","value":1}]}`},
+		},
+		{
+			name:      "simple conditions",
+			arguments: map[string]interface{}{"where_conditions": `name='a',password='x,y', api_key like k%`},
+			want:      map[string]interface{}{"where_conditions": `name='a',password=******, api_key like ******`},
+		},
+		{
+			name:      "transaction steps",
+			arguments: map[string]interface{}{"operations": []interface{}{map[string]interface{}{"query": "insert", "fields": `{"secret":"x"}`}}},
+			want:      map[string]interface{}{"operations": []interface{}{map[string]interface{}{"query": "insert", "fields": `{"secret":"******"}`}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			if err := json.Unmarshal(auditArguments(tt.arguments), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("auditArguments = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
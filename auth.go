@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 角色权限列表中表示"全部"的通配符
+const allowAll = "*"
+
+// database_query 可授权的操作：结构化查询的各操作，以及raw和model查询类型
+var queryOperations = []string{"select", "count", "insert", "update", "delete", "raw", "model"}
+
+// AuthConfig HTTP/SSE传输的认证配置；未配置凭据时不做认证，stdio传输始终不做认证
+type AuthConfig struct {
+	Roles       map[string]RoleConfig `json:"roles" yaml:"roles" toml:"roles"`
+	Credentials []CredentialConfig    `json:"credentials" yaml:"credentials" toml:"credentials"`
+}
+
+// RoleConfig 角色可使用的工具、数据库连接和database_query操作；"*" 表示全部，空列表表示全部禁止
+type RoleConfig struct {
+	Tools       []string `json:"tools" yaml:"tools" toml:"tools"`
+	Connections []string `json:"connections" yaml:"connections" toml:"connections"`
+	Operations  []string `json:"operations" yaml:"operations" toml:"operations"`
+}
+
+// CredentialConfig 一个客户端凭据，通过 Authorization: Bearer <token> 或 X-API-Key: <token> 提交
+type CredentialConfig struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Token string `json:"token" yaml:"token" toml:"token"`
+	Role  string `json:"role" yaml:"role" toml:"role"`
+}
+
+// Principal 已认证的客户端
+type Principal struct {
+	Name string
+	Role string
+	role RoleConfig
+}
+
+type principalContextKey struct{}
+
+// Enabled 是否启用认证
+func (c AuthConfig) Enabled() bool {
+	return len(c.Credentials) > 0
+}
+
+func (c AuthConfig) validate() error {
+	var errs []error
+
+	roleNames := make([]string, 0, len(c.Roles))
+	for name := range c.Roles {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+	for _, name := range roleNames {
+		for _, op := range c.Roles[name].Operations {
+			if op != allowAll && !slices.Contains(queryOperations, op) {
+				errs = append(errs, fmt.Errorf("auth.roles.%s.operations: 未知的操作 %q，可选值: %s", name, op, strings.Join(queryOperations, ", ")))
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, cred := range c.Credentials {
+		if cred.Name == "" {
+			errs = append(errs, fmt.Errorf("auth.credentials[%d]: 必须指定name", i))
+		} else if names[cred.Name] {
+			errs = append(errs, fmt.Errorf("auth.credentials[%d]: 重复的凭据名 %q", i, cred.Name))
+		}
+		names[cred.Name] = true
+
+		if cred.Token == "" {
+			errs = append(errs, fmt.Errorf("auth.credentials[%d]: 凭据 %s 未设置token", i, cred.Name))
+		} else if tokens[cred.Token] {
+			errs = append(errs, fmt.Errorf("auth.credentials[%d]: 凭据 %s 的token与其他凭据重复", i, cred.Name))
+		}
+		tokens[cred.Token] = true
+
+		if _, ok := c.Roles[cred.Role]; !ok {
+			errs = append(errs, fmt.Errorf("auth.credentials[%d]: 凭据 %s 引用了未定义的角色 %q", i, cred.Name, cred.Role))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateToolNames 检查角色中引用的工具名是否都已注册
+func (c AuthConfig) ValidateToolNames(known []string) error {
+	roleNames := make([]string, 0, len(c.Roles))
+	for name := range c.Roles {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+
+	var errs []error
+	for _, name := range roleNames {
+		for _, tool := range c.Roles[name].Tools {
+			if tool != allowAll && !slices.Contains(known, tool) {
+				errs = append(errs, fmt.Errorf("auth.roles.%s.tools: 未知的工具 %q", name, tool))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 按token查找凭据，逐个做常量时间比较
+func (c AuthConfig) authenticate(token string) (*Principal, bool) {
+	var found *Principal
+	for _, cred := range c.Credentials {
+		if subtle.ConstantTimeCompare([]byte(cred.Token), []byte(token)) == 1 {
+			found = &Principal{Name: cred.Name, Role: cred.Role, role: c.Roles[cred.Role]}
+		}
+	}
+	return found, found != nil
+}
+
+// 从请求头中取出token
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// HTTP中间件：校验凭据并把Principal放入请求上下文，工具处理函数从上下文中取出做授权
+func requireAuth(config AuthConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := config.authenticate(requestToken(r))
+		if !ok {
+			log.Printf("拒绝未认证的请求: %s %s (来自 %s)", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+			http.Error(w, "未认证: 请通过 Authorization: Bearer <token> 或 X-API-Key 请求头提供有效凭据", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// 取出当前请求的客户端；stdio传输或未启用认证时没有Principal，不做授权限制
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func allowed(list []string, name string) bool {
+	return slices.Contains(list, allowAll) || slices.Contains(list, name)
+}
+
+// PermissionError 当前客户端无权执行的操作
+type PermissionError struct {
+	Principal *Principal
+	Kind      string
+	Target    string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("权限不足: 凭据 %s (角色 %s) 无权%s %s", e.Principal.Name, e.Principal.Role, e.Kind, e.Target)
+}
+
+// 检查当前客户端能否调用工具
+func authorizeTool(ctx context.Context, tool string) error {
+	principal, ok := principalFromContext(ctx)
+	if !ok || allowed(principal.role.Tools, tool) {
+		return nil
+	}
+	return auditDenied(ctx, &PermissionError{Principal: principal, Kind: "调用工具", Target: tool})
+}
+
+// 检查当前客户端能否使用数据库连接
+func authorizeConnection(ctx context.Context, connection string) error {
+	if connectionVisible(ctx, connection) {
+		return nil
+	}
+	principal, _ := principalFromContext(ctx)
+	return auditDenied(ctx, &PermissionError{Principal: principal, Kind: "使用数据库连接", Target: connection})
+}
+
+// 当前客户端能否看到数据库连接；用于过滤连接列表，看不到的连接不算作被拒绝的访问
+func connectionVisible(ctx context.Context, connection string) bool {
+	principal, ok := principalFromContext(ctx)
+	return !ok || allowed(principal.role.Connections, connection)
+}
+
+// 检查当前客户端能否在连接上执行database_query操作
+func authorizeQuery(ctx context.Context, connection, operation string) error {
+	if err := authorizeConnection(ctx, connection); err != nil {
+		return err
+	}
+	principal, ok := principalFromContext(ctx)
+	if !ok || allowed(principal.role.Operations, operation) {
+		return nil
+	}
+	return auditDenied(ctx, &PermissionError{Principal: principal, Kind: "执行操作", Target: operation})
+}
+
+// 工具调用中间件：拒绝当前角色不允许的工具
+func authorizeToolMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := authorizeTool(ctx, request.Params.Name); err != nil {
+			log.Printf("%v", err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+// tools/list过滤：只列出当前角色可以调用的工具
+func filterToolsByRole(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if _, ok := principalFromContext(ctx); !ok {
+		return tools
+	}
+	filtered := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if authorizeTool(ctx, tool.Name) == nil {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// conditionNode 条件树节点：分组(and/or/not)或单个比较(field/op/value)，例如
+//
+//	{"and":[{"field":"status","op":"in","value":["a","b"]},{"or":[{"field":"age","op":">=","value":18},{"field":"vip","op":"is null"}]}]}
+type conditionNode struct {
+	And   []conditionNode `json:"and,omitempty"`
+	Or    []conditionNode `json:"or,omitempty"`
+	Not   *conditionNode  `json:"not,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value interface{}     `json:"value,omitempty"`
+}
+
+// 支持的比较操作符及其值的形式
+const (
+	valueScalar = iota
+	valueList
+	valueRange
+	valueNone
+)
+
+var conditionOperators = map[string]int{
+	"=":           valueScalar,
+	"!=":          valueScalar,
+	"<>":          valueScalar,
+	">":           valueScalar,
+	">=":          valueScalar,
+	"<":           valueScalar,
+	"<=":          valueScalar,
+	"like":        valueScalar,
+	"not like":    valueScalar,
+	"in":          valueList,
+	"not in":      valueList,
+	"between":     valueRange,
+	"not between": valueRange,
+	"is null":     valueNone,
+	"is not null": valueNone,
+}
+
+// 简单格式中可识别的操作符，同一位置优先匹配更长的
+var simpleOperatorPattern = regexp.MustCompile(`(?i)>=|<=|!=|<>|>|<|=|\s+not\s+like\s+|\s+like\s+`)
+
+// 简单格式中的空值判断：field IS NULL / field IS NOT NULL
+var simpleNullPattern = regexp.MustCompile(`(?i)^(\S+)\s+is\s+(not\s+)?null$`)
+
+// 解析条件参数，支持三种格式：
+//   - 条件树：{"and":[...]}、{"or":[...]}、{"not":{...}}、{"field":"f","op":"in","value":[...]}，顶层也可以是节点数组(按AND组合)
+//   - JSON对象：{"field1":"value1"}，各字段等值比较
+//   - 简单格式：field1=value1,field2>value2，含逗号的值用引号括起来
+func parseConditions(conditions string) (conditionNode, error) {
+	trimmed := strings.TrimSpace(conditions)
+	if trimmed == "" {
+		return conditionNode{}, fmt.Errorf("条件为空")
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var nodes []conditionNode
+		if err := decodeStrict(trimmed, &nodes); err != nil {
+			return conditionNode{}, fmt.Errorf("条件树格式错误: %v", err)
+		}
+		return conditionNode{And: nodes}, nil
+	case '{':
+		var object map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return conditionNode{}, fmt.Errorf("条件JSON格式错误: %v", err)
+		}
+		if !isConditionTree(object) {
+			return equalityConditions(object), nil
+		}
+		var node conditionNode
+		if err := decodeStrict(trimmed, &node); err != nil {
+			return conditionNode{}, fmt.Errorf("条件树格式错误: %v", err)
+		}
+		return node, nil
+	}
+	return parseSimpleConditions(trimmed)
+}
+
+func decodeStrict(data string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// 含有and/or/not，或同时有field和op的对象按条件树解析
+func isConditionTree(object map[string]interface{}) bool {
+	for _, key := range []string{"and", "or", "not"} {
+		if _, ok := object[key]; ok {
+			return true
+		}
+	}
+	_, hasField := object["field"]
+	_, hasOp := object["op"]
+	return hasField && hasOp
+}
+
+// {"field1":"value1"} 形式：各字段等值比较，null表示IS NULL
+func equalityConditions(object map[string]interface{}) conditionNode {
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	node := conditionNode{}
+	for _, field := range fields {
+		if object[field] == nil {
+			node.And = append(node.And, conditionNode{Field: field, Op: "is null"})
+			continue
+		}
+		node.And = append(node.And, conditionNode{Field: field, Op: "=", Value: object[field]})
+	}
+	return node
+}
+
+// 简单格式：逗号分隔的 field op value，按AND组合
+func parseSimpleConditions(conditions string) (conditionNode, error) {
+	node := conditionNode{}
+	for _, condition := range splitOutsideQuotes(conditions, ',') {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+
+		if match := simpleNullPattern.FindStringSubmatch(condition); match != nil {
+			op := "is null"
+			if match[2] != "" {
+				op = "is not null"
+			}
+			node.And = append(node.And, conditionNode{Field: match[1], Op: op})
+			continue
+		}
+
+		// 取最靠左的操作符；正则按顺序尝试，同一位置先匹配较长的操作符
+		loc := simpleOperatorPattern.FindStringIndex(condition)
+		if loc == nil {
+			return conditionNode{}, fmt.Errorf("无法解析条件 %q，格式: field1=value1,field2>value2", condition)
+		}
+		field := strings.TrimSpace(condition[:loc[0]])
+		op := strings.Join(strings.Fields(strings.ToLower(condition[loc[0]:loc[1]])), " ")
+		value := strings.TrimSpace(condition[loc[1]:])
+		if field == "" || value == "" {
+			return conditionNode{}, fmt.Errorf("无法解析条件 %q，格式: field1=value1,field2>value2", condition)
+		}
+
+		node.And = append(node.And, conditionNode{Field: field, Op: op, Value: unquote(value)})
+	}
+	if len(node.And) == 0 {
+		return conditionNode{}, fmt.Errorf("条件为空")
+	}
+	return node, nil
+}
+
+// 按分隔符切分，忽略单双引号内的分隔符
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	var current bytes.Buffer
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(parts, current.String())
+}
+
+// 移除值两边成对的引号
+func unquote(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '\'' || first == '"') && first == last {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// 生成带占位符的SQL和参数；列名经scope校验，allowAggregate时左侧还可以是别名或聚合函数
+func (n conditionNode) build(scope *queryScope, allowAggregate bool, path string) (string, []interface{}, error) {
+	kinds := 0
+	for _, set := range []bool{n.And != nil, n.Or != nil, n.Not != nil, n.Field != "" || n.Op != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return "", nil, fmt.Errorf("%s: 每个节点必须且只能是 and、or、not 或 field/op 之一", path)
+	}
+
+	switch {
+	case n.And != nil:
+		return buildGroup(n.And, "AND", scope, allowAggregate, path+".and")
+	case n.Or != nil:
+		return buildGroup(n.Or, "OR", scope, allowAggregate, path+".or")
+	case n.Not != nil:
+		sql, args, err := n.Not.build(scope, allowAggregate, path+".not")
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", args, nil
+	}
+
+	if n.Field == "" {
+		return "", nil, fmt.Errorf("%s: 缺少field", path)
+	}
+	var column string
+	var err error
+	// 聚合结果是数值，与其比较时数字形式的字符串也按数值比较
+	numeric := false
+	if allowAggregate {
+		column, err = scope.expression(n.Field, true)
+		numeric = scope.numericExpression(n.Field)
+	} else {
+		column, err = scope.column(n.Field)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	op := strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(n.Op, "_", " "))), " ")
+	kind, ok := conditionOperators[op]
+	if !ok {
+		return "", nil, fmt.Errorf("%s: 不支持的操作符 %q，可选值: =, !=, <>, >, >=, <, <=, like, not like, in, not in, between, not between, is null, is not null", path, n.Op)
+	}
+	sqlOp := strings.ToUpper(op)
+
+	switch kind {
+	case valueNone:
+		if n.Value != nil {
+			return "", nil, fmt.Errorf("%s: %s 不需要value", path, sqlOp)
+		}
+		return fmt.Sprintf("%s %s", column, sqlOp), nil, nil
+	case valueList:
+		values, ok := n.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("%s: %s 的value必须是非空数组", path, sqlOp)
+		}
+		for i, v := range values {
+			if !isScalar(v) {
+				return "", nil, fmt.Errorf("%s: %s 的value[%d]必须是字符串、数字或布尔值", path, sqlOp, i)
+			}
+			values[i] = conditionValue(v, numeric)
+		}
+		return fmt.Sprintf("%s %s ?", column, sqlOp), []interface{}{values}, nil
+	case valueRange:
+		values, ok := n.Value.([]interface{})
+		if !ok || len(values) != 2 || !isScalar(values[0]) || !isScalar(values[1]) {
+			return "", nil, fmt.Errorf("%s: %s 的value必须是两个元素的数组 [下限, 上限]", path, sqlOp)
+		}
+		return fmt.Sprintf("%s %s ? AND ?", column, sqlOp),
+			[]interface{}{conditionValue(values[0], numeric), conditionValue(values[1], numeric)}, nil
+	default:
+		if n.Value == nil {
+			return "", nil, fmt.Errorf("%s: %s 需要value，判断空值请使用 is null", path, sqlOp)
+		}
+		if !isScalar(n.Value) {
+			return "", nil, fmt.Errorf("%s: %s 的value必须是字符串、数字或布尔值", path, sqlOp)
+		}
+		return fmt.Sprintf("%s %s ?", column, sqlOp), []interface{}{conditionValue(n.Value, numeric)}, nil
+	}
+}
+
+func buildGroup(nodes []conditionNode, joiner string, scope *queryScope, allowAggregate bool, path string) (string, []interface{}, error) {
+	if len(nodes) == 0 {
+		return "", nil, fmt.Errorf("%s: 条件组不能为空", path)
+	}
+
+	parts := make([]string, 0, len(nodes))
+	var args []interface{}
+	for i, node := range nodes {
+		sql, nodeArgs, err := node.build(scope, allowAggregate, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(nodes) > 1 {
+			sql = "(" + sql + ")"
+		}
+		parts = append(parts, sql)
+		args = append(args, nodeArgs...)
+	}
+	return strings.Join(parts, " "+joiner+" "), args, nil
+}
+
+// 字符串、数字或布尔值；null 只能用 is null 判断，不能出现在 in 列表或比较中
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, json.Number, float64, bool:
+		return true
+	}
+	return false
+}
+
+// 转换为数据库参数：JSON数字转为int64或float64；numericStrings时数字形式的字符串也转为数值
+func conditionValue(v interface{}, numericStrings bool) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case string:
+		if numericStrings {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhereConditions(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	scope, err := newQueryScope(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		conditions string
+		wantSQL    string
+		wantArgs   []interface{}
+		wantErr    string
+	}{
+		{
+			name:       "simple",
+			conditions: "status=active",
+			wantSQL:    "`status` = ?",
+			wantArgs:   []interface{}{"active"},
+		},
+		{
+			name:       "simple with quoted comma",
+			conditions: `name='a,b', id>=2`,
+			wantSQL:    "(`name` = ?) AND (`id` >= ?)",
+			wantArgs:   []interface{}{"a,b", "2"},
+		},
+		{
+			name:       "simple not like and is null",
+			conditions: "email not like %@example.com,deleted_at is null",
+			wantSQL:    "(`email` NOT LIKE ?) AND (`deleted_at` IS NULL)",
+			wantArgs:   []interface{}{"%@example.com"},
+		},
+		{
+			name:       "json object",
+			conditions: `{"status":"active","id":1,"deleted_at":null}`,
+			wantSQL:    "(`deleted_at` IS NULL) AND (`id` = ?) AND (`status` = ?)",
+			wantArgs:   []interface{}{int64(1), "active"},
+		},
+		{
+			name:       "tree",
+			conditions: `{"and":[{"field":"status","op":"in","value":["active","inactive"]},{"or":[{"field":"id","op":">=","value":2},{"not":{"field":"users.name","op":"like","value":"张%"}}]}]}`,
+			wantSQL:    "(`status` IN ?) AND ((`id` >= ?) OR (NOT (`users`.`name` LIKE ?)))",
+			wantArgs:   []interface{}{[]interface{}{"active", "inactive"}, int64(2), "张%"},
+		},
+		{
+			name:       "top-level array",
+			conditions: `[{"field":"id","op":"between","value":[1,2.5]},{"field":"email","op":"is not null"}]`,
+			wantSQL:    "(`id` BETWEEN ? AND ?) AND (`email` IS NOT NULL)",
+			wantArgs:   []interface{}{int64(1), 2.5},
+		},
+		{
+			name:       "numeric strings stay strings in where",
+			conditions: `{"field":"name","op":"=","value":"007"}`,
+			wantSQL:    "`name` = ?",
+			wantArgs:   []interface{}{"007"},
+		},
+		{name: "empty", conditions: " ", wantErr: "条件为空"},
+		{name: "unknown column", conditions: "password=x", wantErr: "列 password 不存在"},
+		{name: "injected column", conditions: `{"field":"id;DROP TABLE users","op":"=","value":1}`, wantErr: "无效的列名"},
+		{name: "unknown table", conditions: "orders.amount>1", wantErr: "表 orders 不在查询中"},
+		{name: "unknown operator", conditions: `{"field":"id","op":"~","value":1}`, wantErr: "不支持的操作符"},
+		{name: "unknown key", conditions: `{"and":[{"field":"id","op":"=","value":1,"extra":true}]}`, wantErr: "条件树格式错误"},
+		{name: "aggregate in where", conditions: "COUNT(*)>1", wantErr: "无效的列名"},
+		{name: "null in list", conditions: `{"field":"id","op":"in","value":[1,null]}`, wantErr: "value[1]"},
+		{name: "empty list", conditions: `{"field":"id","op":"not in","value":[]}`, wantErr: "非空数组"},
+		{name: "null comparison", conditions: `{"field":"id","op":"=","value":null}`, wantErr: "is null"},
+		{name: "value with is null", conditions: `{"field":"id","op":"is null","value":1}`, wantErr: "不需要value"},
+		{name: "open range", conditions: `{"field":"id","op":"between","value":[1,null]}`, wantErr: "两个元素"},
+		{name: "mixed node", conditions: `{"and":[{"field":"id","op":"=","value":1}],"field":"id","op":"="}`, wantErr: "只能是"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := buildTestConditions(scope, tt.conditions, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("条件 %s 的错误 = %v，应包含 %q", tt.conditions, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("条件 %s: %v", tt.conditions, err)
+			}
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("条件 %s 生成 %s %#v，期望 %s %#v", tt.conditions, sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestHavingConditions(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	scope, err := newQueryScope(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scope.selectList("status, COUNT(*) AS total, MAX(name) AS last_name"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		having   string
+		wantSQL  string
+		wantArgs []interface{}
+		wantErr  string
+	}{
+		{"aggregate", "COUNT(*)>=2", "COUNT(*) >= ?", []interface{}{float64(2)}, ""},
+		{"numeric alias", "total>1", "`total` > ?", []interface{}{float64(1)}, ""},
+		{"distinct aggregate", `{"field":"COUNT(DISTINCT email)","op":"=","value":"3"}`, "COUNT(DISTINCT `email`) = ?", []interface{}{float64(3)}, ""},
+		{"group column keeps strings", "status=1", "`status` = ?", []interface{}{"1"}, ""},
+		{"max keeps strings", "MAX(name)=007", "MAX(`name`) = ?", []interface{}{"007"}, ""},
+		{"max alias keeps strings", "last_name>=10", "`last_name` >= ?", []interface{}{"10"}, ""},
+		{"numeric list", `{"field":"total","op":"in","value":["1",2]}`, "`total` IN ?", []interface{}{[]interface{}{float64(1), int64(2)}}, ""},
+		{"null in list", `{"field":"total","op":"not in","value":[null]}`, "", nil, "value[0]"},
+		{"star outside count", "SUM(*)>1", "", nil, "COUNT"},
+		{"unknown column in aggregate", "SUM(amount)>1", "", nil, "列 amount 不存在"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := buildTestConditions(scope, tt.having, true)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("having %s 的错误 = %v，应包含 %q", tt.having, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("having %s: %v", tt.having, err)
+			}
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("having %s 生成 %s %#v，期望 %s %#v", tt.having, sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestGroupedSelectWithHaving(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	request := newTestRequest("database_query", map[string]interface{}{
+		"query":      "select",
+		"table_name": "users",
+		"fields":     "status, COUNT(*) AS total",
+		"group_by":   "status",
+		"having":     "total>=2",
+	})
+	result, err := executeStructuredQuery(db, request, newPageRequest(0, 0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["status"] != "active" {
+		t.Fatalf("HAVING 结果 = %v，期望只有 active 一组", result.Rows)
+	}
+}
+
+func buildTestConditions(scope *queryScope, conditions string, allowAggregate bool) (string, []interface{}, error) {
+	node, err := parseConditions(conditions)
+	if err != nil {
+		return "", nil, err
+	}
+	path := "where"
+	if allowAggregate {
+		path = "having"
+	}
+	return node.build(scope, allowAggregate, path)
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/logger"
+)
+
+// ServerConfig 服务器配置，可从YAML/JSON/TOML文件加载，并可被环境变量覆盖
+type ServerConfig struct {
+	Transport   TransportConfig           `json:"transport" yaml:"transport" toml:"transport"`
+	Auth        AuthConfig                `json:"auth" yaml:"auth" toml:"auth"`
+	Connections map[string]DatabaseConfig `json:"connections" yaml:"connections" toml:"connections"`
+	Tools       ToolsConfig               `json:"tools" yaml:"tools" toml:"tools"`
+	Query       QueryConfig               `json:"query" yaml:"query" toml:"query"`
+	Search      SearchConfig              `json:"search" yaml:"search" toml:"search"`
+	Logging     LoggingConfig             `json:"logging" yaml:"logging" toml:"logging"`
+	Audit       AuditConfig               `json:"audit" yaml:"audit" toml:"audit"`
+
+	RuntimeConnections RuntimeConnectionsConfig `json:"runtime_connections" yaml:"runtime_connections" toml:"runtime_connections"`
+}
+
+// RuntimeConnectionsConfig 通过 db_connect、db_test_connection 在运行时添加连接的限制
+type RuntimeConnectionsConfig struct {
+	// SQLite 数据库文件只能位于该目录下；为空时运行时只能使用 :memory: 数据库
+	SQLiteDir string `json:"sqlite_dir" yaml:"sqlite_dir" toml:"sqlite_dir"`
+}
+
+// ToolsConfig 工具开关；Enabled非空时只注册列出的工具
+type ToolsConfig struct {
+	Enabled  []string `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Disabled []string `json:"disabled" yaml:"disabled" toml:"disabled"`
+}
+
+// QueryConfig 单次查询的限制：返回结果的上限(超出部分通过cursor翻页获取)和默认超时；0表示不限
+type QueryConfig struct {
+	MaxRows  int      `json:"max_rows" yaml:"max_rows" toml:"max_rows"`
+	MaxBytes int      `json:"max_bytes" yaml:"max_bytes" toml:"max_bytes"`
+	Timeout  Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// SearchConfig 网络搜索服务配置
+type SearchConfig struct {
+	Provider       string   `json:"provider" yaml:"provider" toml:"provider"`
+	APIKey         string   `json:"api_key" yaml:"api_key" toml:"api_key"`
+	SearchEngineID string   `json:"search_engine_id" yaml:"search_engine_id" toml:"search_engine_id"`
+	Timeout        Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	MaxResults     int      `json:"max_results" yaml:"max_results" toml:"max_results"`
+}
+
+// LoggingConfig 日志配置；stdio传输占用标准输出，日志只能写到标准错误或文件
+type LoggingConfig struct {
+	File     string `json:"file" yaml:"file" toml:"file"`
+	SQLLevel string `json:"sql_level" yaml:"sql_level" toml:"sql_level"`
+}
+
+// Duration 支持 "30s"、"5m" 这类写法的时间长度
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("无效的时间长度 %q: %v", string(text), err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+var sqlLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// 当前生效的服务器配置
+var appConfig = DefaultConfig()
+
+// 注册过程中见到的全部工具名，用于校验配置中的工具名
+var registeredToolNames []string
+
+// DefaultConfig 未提供配置文件时使用的默认配置；不含任何数据库连接，连接由配置文件或环境变量提供
+func DefaultConfig() *ServerConfig {
+	return &ServerConfig{
+		Transport: TransportConfig{
+			Type:            transportStdio,
+			Address:         ":8080",
+			BasePath:        "/mcp",
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		Connections: make(map[string]DatabaseConfig),
+		Query: QueryConfig{
+			MaxRows:  1000,
+			MaxBytes: 1 << 20,
+			Timeout:  Duration(30 * time.Second),
+		},
+		Search: SearchConfig{
+			Provider:   "google",
+			Timeout:    Duration(10 * time.Second),
+			MaxResults: 20,
+		},
+		Logging: LoggingConfig{
+			SQLLevel: "info",
+		},
+	}
+}
+
+// LoadConfig 读取配置文件(path为空时使用默认配置)，应用环境变量覆盖并校验
+func LoadConfig(path string) (*ServerConfig, error) {
+	config := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+
+		config.Connections = nil
+		if err := decodeConfig(path, data, config); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+		if config.Connections == nil {
+			config.Connections = make(map[string]DatabaseConfig)
+		}
+	}
+
+	config.applyEnv(os.Environ())
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("配置校验失败:\n%v", err)
+	}
+	return config, nil
+}
+
+// 按文件扩展名选择解析格式
+func decodeConfig(path string, data []byte, config *ServerConfig) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(config)
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("未知的配置项: %v", undecoded)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的配置文件格式 %q，请使用 .yaml、.json 或 .toml", filepath.Ext(path))
+	}
+}
+
+// 环境变量覆盖：
+//   - DB_DRIVER/DB_DSN/DB_HOST/DB_PORT/DB_NAME/DB_USER/DB_PASSWORD 作用于 default 连接
+//   - MCP_DB_<NAME>_<FIELD> 作用于名为 <name> 的连接，FIELD 为 DRIVER/DSN/HOST/PORT/DATABASE/USERNAME/PASSWORD
+//   - GOOGLE_API_KEY、GOOGLE_SEARCH_ENGINE_ID、MCP_SEARCH_PROVIDER
+//   - MCP_TOOLS_ENABLED、MCP_TOOLS_DISABLED (逗号分隔)
+//   - MCP_QUERY_MAX_ROWS、MCP_QUERY_MAX_BYTES、MCP_QUERY_TIMEOUT
+//   - MCP_LOG_FILE、MCP_SQL_LOG_LEVEL
+//   - MCP_AUDIT_FILE、MCP_AUDIT_CONNECTION、MCP_AUDIT_TABLE
+//   - MCP_TRANSPORT、MCP_LISTEN_ADDR、MCP_BASE_PATH
+//   - MCP_AUTH_<NAME>_TOKEN 设置名为 <name> 的凭据的token，便于不把密钥写进配置文件
+func (c *ServerConfig) applyEnv(environ []string) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	legacy := map[string]string{
+		"DB_DRIVER":   "DRIVER",
+		"DB_DSN":      "DSN",
+		"DB_HOST":     "HOST",
+		"DB_PORT":     "PORT",
+		"DB_NAME":     "DATABASE",
+		"DB_USER":     "USERNAME",
+		"DB_PASSWORD": "PASSWORD",
+	}
+	for key, field := range legacy {
+		if value, ok := lookup(key); ok {
+			c.setConnectionField(c.envConnectionName("default"), field, value)
+		}
+	}
+
+	for key, value := range env {
+		rest, ok := strings.CutPrefix(key, "MCP_DB_")
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"DRIVER", "DSN", "HOST", "PORT", "DATABASE", "USERNAME", "PASSWORD"} {
+			name, ok := strings.CutSuffix(rest, "_"+field)
+			if ok && name != "" {
+				c.setConnectionField(c.envConnectionName(name), field, value)
+				break
+			}
+		}
+	}
+
+	if value, ok := lookup("GOOGLE_API_KEY"); ok {
+		c.Search.APIKey = value
+	}
+	if value, ok := lookup("GOOGLE_SEARCH_ENGINE_ID"); ok {
+		c.Search.SearchEngineID = value
+	}
+	if value, ok := lookup("MCP_SEARCH_PROVIDER"); ok {
+		c.Search.Provider = value
+	}
+	if value, ok := lookup("MCP_TOOLS_ENABLED"); ok {
+		c.Tools.Enabled = splitList(value)
+	}
+	if value, ok := lookup("MCP_TOOLS_DISABLED"); ok {
+		c.Tools.Disabled = splitList(value)
+	}
+	if value, ok := lookup("MCP_QUERY_MAX_ROWS"); ok {
+		c.Query.MaxRows = envInt(value)
+	}
+	if value, ok := lookup("MCP_QUERY_MAX_BYTES"); ok {
+		c.Query.MaxBytes = envInt(value)
+	}
+	if value, ok := lookup("MCP_QUERY_TIMEOUT"); ok {
+		// 非法值留给Validate报告
+		if err := c.Query.Timeout.UnmarshalText([]byte(value)); err != nil {
+			c.Query.Timeout = -1
+		}
+	}
+	if value, ok := lookup("MCP_LOG_FILE"); ok {
+		c.Logging.File = value
+	}
+	if value, ok := lookup("MCP_SQL_LOG_LEVEL"); ok {
+		c.Logging.SQLLevel = value
+	}
+	if value, ok := lookup("MCP_AUDIT_FILE"); ok {
+		c.Audit.File = value
+	}
+	if value, ok := lookup("MCP_AUDIT_CONNECTION"); ok {
+		c.Audit.Connection = value
+	}
+	if value, ok := lookup("MCP_AUDIT_TABLE"); ok {
+		c.Audit.Table = value
+	}
+	if value, ok := lookup("MCP_TRANSPORT"); ok {
+		c.Transport.Type = value
+	}
+	if value, ok := lookup("MCP_LISTEN_ADDR"); ok {
+		c.Transport.Address = value
+	}
+	if value, ok := lookup("MCP_BASE_PATH"); ok {
+		c.Transport.BasePath = value
+	}
+
+	for key, value := range env {
+		rest, ok := strings.CutPrefix(key, "MCP_AUTH_")
+		if !ok {
+			continue
+		}
+		if name, ok := strings.CutSuffix(rest, "_TOKEN"); ok && name != "" {
+			c.setCredentialToken(strings.ToLower(name), value)
+		}
+	}
+}
+
+// 设置凭据的token，凭据不存在时新增(角色需在配置文件中指定，否则由Validate报告)
+func (c *ServerConfig) setCredentialToken(name, token string) {
+	for i := range c.Auth.Credentials {
+		if strings.EqualFold(c.Auth.Credentials[i].Name, name) {
+			c.Auth.Credentials[i].Token = token
+			return
+		}
+	}
+	c.Auth.Credentials = append(c.Auth.Credentials, CredentialConfig{Name: name, Token: token})
+}
+
+// 环境变量中的连接名不区分大小写地对应已配置的连接，没有对应的连接时新增小写名称的连接
+func (c *ServerConfig) envConnectionName(name string) string {
+	for _, configured := range c.ConnectionNames() {
+		if strings.EqualFold(configured, name) {
+			return configured
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// 设置连接的一个字段，连接不存在时新增(主机默认为localhost)
+func (c *ServerConfig) setConnectionField(name, field, value string) {
+	config, ok := c.Connections[name]
+	if !ok {
+		config.Host = "localhost"
+	}
+	switch field {
+	case "DRIVER":
+		config.Driver = value
+	case "DSN":
+		config.DSN = value
+	case "HOST":
+		config.Host = value
+	case "PORT":
+		config.Port = envInt(value)
+	case "DATABASE":
+		config.Database = value
+	case "USERNAME":
+		config.Username = value
+	case "PASSWORD":
+		config.Password = value
+	}
+	c.Connections[name] = config
+}
+
+// Validate 校验配置，返回所有发现的问题
+func (c *ServerConfig) Validate() error {
+	var errs []error
+
+	if err := c.Transport.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Auth.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Audit.validate(c.Connections); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, name := range c.ConnectionNames() {
+		config := c.Connections[name]
+		if _, err := LookupDriver(config.Driver); err != nil {
+			errs = append(errs, fmt.Errorf("connections.%s: %v", name, err))
+		}
+		if config.DSN == "" && config.Database == "" {
+			errs = append(errs, fmt.Errorf("connections.%s: 必须指定dsn或database", name))
+		}
+		if config.Port < 0 || config.Port > 65535 {
+			errs = append(errs, fmt.Errorf("connections.%s: 无效的端口 %d", name, config.Port))
+		}
+		if config.MaxIdleConns < 0 || config.MaxOpenConns < 0 || config.ConnMaxLifetime < 0 {
+			errs = append(errs, fmt.Errorf("connections.%s: 连接池参数不能为负数", name))
+		}
+		if config.QueryTimeout < 0 {
+			errs = append(errs, fmt.Errorf("connections.%s: query_timeout 不能为负数", name))
+		}
+		if err := config.validateConfirm(); err != nil {
+			errs = append(errs, fmt.Errorf("connections.%s: %v", name, err))
+		}
+		if err := config.validateAccess(); err != nil {
+			errs = append(errs, fmt.Errorf("connections.%s: %v", name, err))
+		}
+		if err := config.validateCost(); err != nil {
+			errs = append(errs, fmt.Errorf("connections.%s: %v", name, err))
+		}
+	}
+
+	if c.Query.MaxRows < 0 {
+		errs = append(errs, fmt.Errorf("query.max_rows: 不能为负数"))
+	}
+	if c.Query.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("query.max_bytes: 不能为负数"))
+	}
+	if c.Query.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("query.timeout: 无效的时间长度"))
+	}
+
+	switch strings.ToLower(c.Search.Provider) {
+	case "google", "":
+	default:
+		errs = append(errs, fmt.Errorf("search.provider: 不支持的搜索服务 %q", c.Search.Provider))
+	}
+	if c.Search.MaxResults < 0 {
+		errs = append(errs, fmt.Errorf("search.max_results: 不能为负数"))
+	}
+
+	if _, ok := sqlLogLevels[strings.ToLower(c.Logging.SQLLevel)]; !ok {
+		errs = append(errs, fmt.Errorf("logging.sql_level: 无效的日志级别 %q，可选值: silent, error, warn, info", c.Logging.SQLLevel))
+	}
+
+	if dir := c.RuntimeConnections.SQLiteDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("runtime_connections.sqlite_dir: %s 不是已存在的目录", dir))
+		}
+	}
+
+	if len(c.Tools.Enabled) > 0 && len(c.Tools.Disabled) > 0 {
+		errs = append(errs, fmt.Errorf("tools: enabled 和 disabled 不能同时设置"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateToolNames 检查配置中引用的工具名是否都已注册
+func (c ToolsConfig) ValidateToolNames(known []string) error {
+	knownSet := make(map[string]bool, len(known))
+	for _, name := range known {
+		knownSet[name] = true
+	}
+
+	var errs []error
+	for _, name := range append(append([]string{}, c.Enabled...), c.Disabled...) {
+		if !knownSet[name] {
+			errs = append(errs, fmt.Errorf("tools: 未知的工具 %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsEnabled 判断工具是否启用
+func (c ToolsConfig) IsEnabled(name string) bool {
+	if len(c.Enabled) > 0 {
+		return slices.Contains(c.Enabled, name)
+	}
+	return !slices.Contains(c.Disabled, name)
+}
+
+// ConnectionNames 按名称顺序返回配置中的连接
+func (c *ServerConfig) ConnectionNames() []string {
+	names := make([]string, 0, len(c.Connections))
+	for name := range c.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SQLLogLevel 返回gorm日志级别
+func (c LoggingConfig) SQLLogLevel() logger.LogLevel {
+	if level, ok := sqlLogLevels[strings.ToLower(c.SQLLevel)]; ok {
+		return level
+	}
+	return logger.Info
+}
+
+// 设置日志输出，返回需要在退出时关闭的文件
+func setupLogging(config LoggingConfig) (io.Closer, error) {
+	if config.File == "" {
+		log.SetOutput(os.Stderr)
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开日志文件失败: %v", err)
+	}
+	log.SetOutput(file)
+	return file, nil
+}
+
+// 按配置注册工具，被禁用的工具不会出现在tools/list中
+func addTool(s *server.MCPServer, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	registeredToolNames = append(registeredToolNames, tool.Name)
+	if !appConfig.Tools.IsEnabled(tool.Name) {
+		log.Printf("工具 %s 已被配置禁用", tool.Name)
+		return
+	}
+	s.AddTool(tool, handler)
+}
+
+// 解析环境变量中的整数，非法值返回-1留给Validate报告
+func envInt(value string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
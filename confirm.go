@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+)
+
+// 确认令牌的有效期，也是等待用户在客户端中确认的最长时间
+const confirmTokenTTL = 5 * time.Minute
+
+// 未配置 confirm_operations 时需要确认的操作
+var defaultConfirmOperations = []string{"update", "delete"}
+
+// 签名确认令牌的密钥，每次启动时随机生成，重启后之前的令牌失效
+var confirmSecret = func() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("生成确认令牌密钥失败: %v", err))
+	}
+	return secret
+}()
+
+// ConfirmationRequiredError 写操作影响的记录数超过了连接的确认阈值
+type ConfirmationRequiredError struct {
+	Database  string
+	Operation string
+	Table     string
+	Rows      int64 // 将影响(或已影响后回滚)的记录数
+	Limit     int64 // 无需确认即可执行的记录数
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("%s 操作将影响表 %s 中的 %d 条记录，超过连接 %s 允许直接执行的 %d 条",
+		strings.ToUpper(e.Operation), e.Table, e.Rows, e.Database, e.Limit)
+}
+
+func (e *ConfirmationRequiredError) connection() string {
+	return e.Database
+}
+
+func (e *ConfirmationRequiredError) choice() string {
+	return fmt.Sprintf("选中后将%s %d 条记录", writeVerb(e.Operation), e.Rows)
+}
+
+func (e *ConfirmationRequiredError) record(claims *confirmClaims) {
+	claims.Rows = e.Rows
+}
+
+// confirmation 需要用户确认才能继续执行的操作：写操作影响的记录数或查询的估计代价超过了阈值
+type confirmation interface {
+	error
+	connection() string           // 连接名，确认令牌与它绑定
+	choice() string               // elicitation 中确认选项的说明
+	record(claims *confirmClaims) // 把确认的数量记入令牌
+}
+
+// 校验连接的确认配置
+func (c DatabaseConfig) validateConfirm() error {
+	if c.ConfirmThreshold < 0 {
+		return fmt.Errorf("confirm_threshold 不能为负数")
+	}
+	for _, operation := range c.ConfirmOperations {
+		switch strings.ToLower(operation) {
+		case "insert", "update", "delete":
+		default:
+			return fmt.Errorf("confirm_operations: 不支持的操作 %q，可选值: insert, update, delete", operation)
+		}
+	}
+	return nil
+}
+
+// writeGuard 按连接配置检查写操作影响的记录数
+type writeGuard struct {
+	database   string
+	threshold  int64
+	operations map[string]bool
+	confirmed  int64 // 用户已确认的记录数
+}
+
+func newWriteGuard(database string, config DatabaseConfig) *writeGuard {
+	operations := config.ConfirmOperations
+	if len(operations) == 0 {
+		operations = defaultConfirmOperations
+	}
+	guard := &writeGuard{database: database, threshold: config.ConfirmThreshold, operations: make(map[string]bool)}
+	for _, operation := range operations {
+		guard.operations[strings.ToLower(operation)] = true
+	}
+	return guard
+}
+
+// 该操作是否需要检查
+func (g *writeGuard) applies(operation string) bool {
+	return g.threshold > 0 && g.operations[strings.ToLower(operation)]
+}
+
+// 影响的记录数超过阈值且超过已确认的数量时返回 *ConfirmationRequiredError
+func (g *writeGuard) check(operation, table string, rows int64) error {
+	limit := max(g.threshold, g.confirmed)
+	if !g.applies(operation) || rows <= limit {
+		return nil
+	}
+	return &ConfirmationRequiredError{Database: g.database, Operation: operation, Table: table, Rows: rows, Limit: limit}
+}
+
+// 检查执行结果，需要确认时返回错误使外层事务回滚
+func (g *writeGuard) checkResult(operation string, result *QueryResult) error {
+	if result.RowsAffected == nil {
+		return nil
+	}
+	return g.check(operation, result.Table, *result.RowsAffected)
+}
+
+// 在事务中执行已确认的写操作：确认之后数据可能变化，实际影响的记录数超过已确认的数量时回滚
+func (g *writeGuard) execute(db *gorm.DB, operation string, write func(tx *gorm.DB) (*QueryResult, error)) (*QueryResult, error) {
+	var result *QueryResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if result, err = write(tx); err != nil {
+			return err
+		}
+		if err := g.checkResult(operation, result); err != nil {
+			return fmt.Errorf("%v，已回滚，请重新调用以确认", err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// 读取并校验请求中的 confirm_token，有效时记下已确认的记录数
+func (g *writeGuard) acceptToken(ctx context.Context, tool string, request mcp.CallToolRequest) error {
+	claims, err := acceptConfirmToken(ctx, tool, g.database, request)
+	if err != nil {
+		return err
+	}
+	g.confirmed = claims.Rows
+	return nil
+}
+
+// 读取并校验请求中的 confirm_token，没有令牌时返回空的内容。令牌只能使用一次，
+// 同一次调用需要多处已确认的数量时只调用一次
+func acceptConfirmToken(ctx context.Context, tool, database string, request mcp.CallToolRequest) (confirmClaims, error) {
+	token := request.GetString("confirm_token", "")
+	if token == "" {
+		return confirmClaims{}, nil
+	}
+	return verifyConfirmToken(ctx, tool, database, request.GetArguments(), token)
+}
+
+// 估算结构化写操作将影响的记录数：UPDATE/DELETE 为WHERE条件匹配的记录数，INSERT 为要写入的记录数
+func countStructuredWrite(db *gorm.DB, request mcp.CallToolRequest) (int64, error) {
+	var write *structuredWrite
+	var err error
+	switch strings.ToLower(request.GetString("query", "")) {
+	case "update":
+		write, err = parseStructuredUpdate(db, request)
+	case "delete":
+		write, err = parseStructuredDelete(db, request)
+	default:
+		insert, err := parseStructuredInsert(db, request)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(insert.rows)), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	query, err := write.filtered(db)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = query.Count(&count).Error
+	return count, err
+}
+
+// 请求用户确认。客户端支持 elicitation 时直接在客户端询问用户；
+// 否则返回带确认令牌的错误结果，调用方需用相同的参数加上 confirm_token 再次调用。
+// confirmed 为本次调用中已确认的数量，一并写入新的令牌。返回 nil 表示用户已确认，可以继续执行
+func requestConfirmation(ctx context.Context, tool string, arguments map[string]interface{}, need confirmation, confirmed confirmClaims) *mcp.CallToolResult {
+	if clientSupportsElicitation(ctx) {
+		accepted, err := elicitConfirmation(ctx, need)
+		if err == nil {
+			if accepted {
+				return nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("%s，用户拒绝执行", need.Error()))
+		}
+		log.Printf("请求用户确认失败，改为返回确认令牌: %v", err)
+	}
+
+	need.record(&confirmed)
+	token, err := issueConfirmToken(ctx, tool, need.connection(), arguments, confirmed)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return mcp.NewToolResultError(fmt.Sprintf(
+		"%s，尚未执行。请先向用户说明并取得同意，然后使用完全相同的参数并加上 confirm_token 再次调用(%s内有效):\nconfirm_token=%s",
+		need.Error(), confirmTokenTTL, token))
+}
+
+// 当前会话的客户端是否声明了 elicitation 能力
+func clientSupportsElicitation(ctx context.Context) bool {
+	session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo)
+	return ok && session.GetClientCapabilities().Elicitation != nil
+}
+
+// 通过 elicitation 询问用户是否继续
+func elicitConfirmation(ctx context.Context, need confirmation) (bool, error) {
+	mcpServer := server.ServerFromContext(ctx)
+	if mcpServer == nil {
+		return false, server.ErrNoActiveSession
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTokenTTL)
+	defer cancel()
+	result, err := mcpServer.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: need.Error() + "。是否继续执行？",
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"confirm": map[string]any{
+						"type":        "boolean",
+						"title":       "确认执行",
+						"description": need.choice(),
+					},
+				},
+				"required": []string{"confirm"},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.Action != mcp.ElicitationResponseActionAccept {
+		return false, nil
+	}
+	content, _ := result.Content.(map[string]any)
+	confirmed, _ := content["confirm"].(bool)
+	return confirmed, nil
+}
+
+func writeVerb(operation string) string {
+	switch strings.ToLower(operation) {
+	case "insert":
+		return "插入"
+	case "delete":
+		return "删除"
+	}
+	return "更新"
+}
+
+// confirmClaims 确认令牌的内容
+type confirmClaims struct {
+	Rows    int64  `json:"r"`           // 已确认的写操作影响的记录数
+	Cost    *int64 `json:"c,omitempty"` // 已确认的查询估计扫描行数
+	Expires int64  `json:"e"`           // 过期时间(Unix秒)
+	Nonce   string `json:"n"`           // 随机值，用于拒绝重复使用的令牌
+}
+
+// 已使用的确认令牌的随机值及其过期时间，过期后不再需要记录
+var usedConfirmTokens = struct {
+	sync.Mutex
+	nonces map[string]int64
+}{nonces: make(map[string]int64)}
+
+// 记录令牌已被使用，令牌之前已使用过时返回false
+func useConfirmToken(claims confirmClaims) bool {
+	usedConfirmTokens.Lock()
+	defer usedConfirmTokens.Unlock()
+
+	now := time.Now().Unix()
+	for nonce, expires := range usedConfirmTokens.nonces {
+		if now > expires {
+			delete(usedConfirmTokens.nonces, nonce)
+		}
+	}
+	if _, used := usedConfirmTokens.nonces[claims.Nonce]; used {
+		return false
+	}
+	usedConfirmTokens.nonces[claims.Nonce] = claims.Expires
+	return true
+}
+
+// 签发确认令牌，令牌与客户端身份、工具、连接和调用参数绑定，只能使用一次
+func issueConfirmToken(ctx context.Context, tool, database string, arguments map[string]interface{}, claims confirmClaims) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成确认令牌失败: %v", err)
+	}
+	claims.Nonce = base64.RawURLEncoding.EncodeToString(nonce)
+	claims.Expires = time.Now().Add(confirmTokenTTL).Unix()
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature, err := confirmSignature(ctx, tool, database, arguments, payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// 校验确认令牌并记为已使用，返回其中已确认的数量
+func verifyConfirmToken(ctx context.Context, tool, database string, arguments map[string]interface{}, token string) (confirmClaims, error) {
+	payload, encodedSignature, ok := strings.Cut(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if !ok || err != nil {
+		return confirmClaims{}, errors.New("无效的 confirm_token")
+	}
+	expected, err := confirmSignature(ctx, tool, database, arguments, payload)
+	if err != nil {
+		return confirmClaims{}, err
+	}
+	if !hmac.Equal(signature, expected) {
+		return confirmClaims{}, errors.New("无效的 confirm_token：令牌已被修改或与本次调用的参数不符")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	var claims confirmClaims
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return confirmClaims{}, errors.New("无效的 confirm_token")
+	}
+	if time.Now().Unix() > claims.Expires {
+		return confirmClaims{}, errors.New("confirm_token 已过期，请重新调用以获取新的令牌")
+	}
+	if claims.Nonce == "" || !useConfirmToken(claims) {
+		return confirmClaims{}, errors.New("confirm_token 已被使用，每个令牌只能使用一次，请重新调用以获取新的令牌")
+	}
+	return claims, nil
+}
+
+// 对令牌内容、客户端身份和调用参数签名；confirm_token 和 timeout_ms 不参与签名
+func confirmSignature(ctx context.Context, tool, database string, arguments map[string]interface{}, payload string) ([]byte, error) {
+	signed := make(map[string]interface{}, len(arguments))
+	for key, value := range arguments {
+		if key != "confirm_token" && key != "timeout_ms" {
+			signed[key] = value
+		}
+	}
+	data, err := json.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	client := ""
+	if principal, ok := principalFromContext(ctx); ok {
+		client = principal.Name
+	}
+	mac := hmac.New(sha256.New, confirmSecret)
+	for _, part := range []string{payload, client, tool, database} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
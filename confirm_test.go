@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfirmToken(t *testing.T) {
+	ctx := context.Background()
+	arguments := map[string]interface{}{"query": "delete", "table_name": "users", "where_conditions": "status=inactive"}
+
+	// confirm_token 和 timeout_ms 不参与签名，其他参数必须与签发时相同
+	withToken := map[string]interface{}{"confirm_token": "x", "timeout_ms": 100}
+	for key, value := range arguments {
+		withToken[key] = value
+	}
+	alice := context.WithValue(ctx, principalContextKey{}, &Principal{Name: "alice"})
+	changed := map[string]interface{}{"query": "delete", "table_name": "users", "where_conditions": "status=active"}
+	unchanged := func(token string) string { return token }
+	unsigned := func(token string) string { return strings.Split(token, ".")[0] }
+	garbage := func(string) string { return "not-a-token" }
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		tool      string
+		database  string
+		arguments map[string]interface{}
+		token     func(token string) string // 由新签发的令牌得到本次使用的令牌
+		wantErr   string
+	}{
+		{"same call", ctx, "database_query", "default", arguments, unchanged, ""},
+		{"retry with token and timeout", ctx, "database_query", "default", withToken, unchanged, ""},
+		{"changed arguments", ctx, "database_query", "default", changed, unchanged, "已被修改或与本次调用的参数不符"},
+		{"other tool", ctx, "database_transaction", "default", arguments, unchanged, "已被修改"},
+		{"other connection", ctx, "database_query", "analytics", arguments, unchanged, "已被修改"},
+		{"other client", alice, "database_query", "default", arguments, unchanged, "已被修改"},
+		{"tampered claims", ctx, "database_query", "default", arguments, tamperConfirmToken, "已被修改"},
+		{"no signature", ctx, "database_query", "default", arguments, unsigned, "无效的 confirm_token"},
+		{"garbage", ctx, "database_query", "default", arguments, garbage, "无效的 confirm_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := issueConfirmToken(ctx, "database_query", "default", arguments, confirmClaims{Rows: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := verifyConfirmToken(tt.ctx, tt.tool, tt.database, tt.arguments, tt.token(token))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyConfirmToken 的错误 = %v，应包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || claims.Rows != 5 || claims.Cost != nil {
+				t.Fatalf("令牌内容 = %+v, %v，期望 Rows=5", claims, err)
+			}
+		})
+	}
+}
+
+func TestConfirmTokenSingleUse(t *testing.T) {
+	ctx := context.Background()
+	arguments := map[string]interface{}{"query": "delete", "table_name": "users", "where_conditions": "status=inactive"}
+	token, err := issueConfirmToken(ctx, "database_query", "default", arguments, confirmClaims{Rows: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 校验失败不消耗令牌
+	if _, err := verifyConfirmToken(ctx, "database_query", "default", map[string]interface{}{"query": "update"}, token); err == nil {
+		t.Fatal("参数不同时令牌应当无效")
+	}
+	if _, err := verifyConfirmToken(ctx, "database_query", "default", arguments, token); err != nil {
+		t.Fatalf("第一次使用令牌失败: %v", err)
+	}
+	if _, err := verifyConfirmToken(ctx, "database_query", "default", arguments, token); err == nil || !strings.Contains(err.Error(), "已被使用") {
+		t.Fatalf("重复使用令牌的错误 = %v，应包含 已被使用", err)
+	}
+}
+
+func TestConfirmTokenExpired(t *testing.T) {
+	ctx := context.Background()
+	arguments := map[string]interface{}{"query": "update"}
+	data, _ := json.Marshal(confirmClaims{Rows: 1, Expires: time.Now().Add(-time.Second).Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature, err := confirmSignature(ctx, "database_query", "default", arguments, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+	if _, err := verifyConfirmToken(ctx, "database_query", "default", arguments, token); err == nil || !strings.Contains(err.Error(), "已过期") {
+		t.Fatalf("过期令牌的错误 = %v，应包含 已过期", err)
+	}
+}
+
+func TestWriteConfirmation(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{ConfirmThreshold: 1})
+	arguments := map[string]interface{}{
+		"query_type":       "structured",
+		"query":            "update",
+		"table_name":       "users",
+		"fields":           `{"status":"inactive"}`,
+		"where_conditions": "status=active",
+	}
+
+	// 客户端不支持 elicitation 时返回确认令牌，数据保持不变
+	result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", arguments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := resultText(result)
+	if !result.IsError || !strings.Contains(text, "confirm_token=") {
+		t.Fatalf("超过阈值的更新应返回确认令牌，实际: %s", text)
+	}
+	if count := countTestRows(t, "users", "status = 'active'"); count != 2 {
+		t.Fatalf("确认前 active 用户数 = %d，期望 2", count)
+	}
+
+	token := text[strings.LastIndex(text, "confirm_token=")+len("confirm_token="):]
+	arguments["confirm_token"] = strings.TrimSpace(token)
+	result, err = handleDatabaseQuery(context.Background(), newTestRequest("database_query", arguments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("带令牌重新调用失败: %s", resultText(result))
+	}
+	if count := countTestRows(t, "users", "status = 'active'"); count != 0 {
+		t.Fatalf("确认后 active 用户数 = %d，期望 0", count)
+	}
+
+	// 同一个令牌不能再次授权写操作
+	result, err = handleDatabaseQuery(context.Background(), newTestRequest("database_query", arguments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || !strings.Contains(resultText(result), "已被使用") {
+		t.Fatalf("重复使用令牌应当被拒绝，实际: %s", resultText(result))
+	}
+}
+
+// 修改令牌中的记录数而不重新签名
+func tamperConfirmToken(token string) string {
+	payload, signature, _ := strings.Cut(token, ".")
+	data, _ := base64.RawURLEncoding.DecodeString(payload)
+	var claims confirmClaims
+	json.Unmarshal(data, &claims)
+	claims.Rows = 1000000
+	data, _ = json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + signature
+}
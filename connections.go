@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ConnectionInfo 连接列表中展示的连接信息，密码已脱敏
+type ConnectionInfo struct {
+	Name   string         `json:"name"`
+	Status string         `json:"status"`
+	Config DatabaseConfig `json:"config"`
+}
+
+const redactedPassword = "******"
+
+// password=xxx 形式的键值对DSN
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password|pwd)=([^;&\s]*)`)
+
+// RemoveConnection 关闭并移除指定的数据库连接
+func (dm *DatabaseManager) RemoveConnection(name string) error {
+	dm.mutex.Lock()
+	conn, exists := dm.connections[name]
+	if !exists {
+		dm.mutex.Unlock()
+		return fmt.Errorf("数据库连接 %s 不存在", name)
+	}
+	delete(dm.connections, name)
+	dm.mutex.Unlock()
+
+	// 等待可能正在进行的建连过程结束
+	conn.connectMu.Lock()
+	defer conn.connectMu.Unlock()
+
+	conn.mu.Lock()
+	db := conn.db
+	conn.db = nil
+	conn.mu.Unlock()
+
+	if db != nil {
+		if err := closeDatabase(db); err != nil {
+			return fmt.Errorf("关闭数据库连接 %s 失败: %v", name, err)
+		}
+	}
+
+	log.Printf("数据库连接 %s 已移除", name)
+	return nil
+}
+
+// Close 关闭所有数据库连接
+func (dm *DatabaseManager) Close() {
+	dm.mutex.RLock()
+	names := make([]string, 0, len(dm.connections))
+	for name := range dm.connections {
+		names = append(names, name)
+	}
+	dm.mutex.RUnlock()
+
+	for _, name := range names {
+		if err := dm.RemoveConnection(name); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+}
+
+// ListConnections 按名称顺序返回所有连接的配置，密码已脱敏
+func (dm *DatabaseManager) ListConnections() []ConnectionInfo {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	infos := make([]ConnectionInfo, 0, len(dm.connections))
+	for name, conn := range dm.connections {
+		conn.mu.Lock()
+		status := conn.status
+		conn.mu.Unlock()
+		infos = append(infos, ConnectionInfo{Name: name, Status: status, Config: conn.config.Redacted()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// ConnectionConfig 返回指定连接的配置
+func (dm *DatabaseManager) ConnectionConfig(name string) (DatabaseConfig, error) {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	conn, exists := dm.connections[name]
+	if !exists {
+		return DatabaseConfig{}, fmt.Errorf("数据库连接 %s 不存在", name)
+	}
+	return conn.config, nil
+}
+
+// PingConnection 检查指定连接是否可用
+func (dm *DatabaseManager) PingConnection(ctx context.Context, name string) error {
+	db, err := dm.GetConnection(name)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("无法获取数据库连接 %s: %v", name, err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("无法连接到数据库 %s: %v", name, err)
+	}
+	return nil
+}
+
+// Redacted 返回隐藏了密码的配置副本
+func (c DatabaseConfig) Redacted() DatabaseConfig {
+	if c.Password != "" {
+		c.Password = redactedPassword
+	}
+	c.DSN = redactDSN(c.DSN)
+	return c
+}
+
+// 隐藏DSN中的密码，兼容 user:pass@tcp(...)、URL 和 key=value 三种写法
+func redactDSN(dsn string) string {
+	if dsn == "" {
+		return dsn
+	}
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			// url.UserPassword 会转义 *，直接拼接隐藏后的账号部分
+			userinfo := url.User(u.User.Username()).String() + ":" + redactedPassword + "@"
+			u.User = nil
+			dsn = strings.Replace(u.String(), "//", "//"+userinfo, 1)
+		}
+	} else if config, err := mysqldriver.ParseDSN(dsn); err == nil && config.Passwd != "" {
+		// 密码中可以含有 @，按MySQL驱动的规则找出账号部分：user:password@ 总在DSN开头
+		dsn = config.User + ":" + redactedPassword + dsn[len(config.User)+1+len(config.Passwd):]
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}="+redactedPassword)
+}
+
+// 注册数据库连接管理工具
+func registerConnectionTools(s *server.MCPServer) {
+	connectTool := mcp.NewTool("db_connect",
+		mcp.WithDescription("添加一个命名的数据库连接，添加后可在database_query的database参数中使用"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("连接名称"),
+		),
+		withDatabaseConfigArgs(),
+	)
+	addTool(s, connectTool, handleDBConnect)
+
+	disconnectTool := mcp.NewTool("db_disconnect",
+		mcp.WithDescription("关闭并移除一个命名的数据库连接"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("连接名称"),
+		),
+	)
+	addTool(s, disconnectTool, handleDBDisconnect)
+
+	listTool := mcp.NewTool("db_list_connections",
+		mcp.WithDescription("列出当前所有数据库连接(密码已隐藏)"),
+	)
+	addTool(s, listTool, handleDBListConnections)
+
+	testTool := mcp.NewTool("db_test_connection",
+		mcp.WithDescription("测试数据库连接：指定name时检查已有连接，否则使用给定配置尝试连接但不保存"),
+		mcp.WithString("name",
+			mcp.Description("已有连接名称"),
+		),
+		withDatabaseConfigArgs(),
+	)
+	addTool(s, testTool, handleDBTestConnection)
+}
+
+// db_connect/db_test_connection 共用的连接配置参数
+func withDatabaseConfigArgs() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithString("driver",
+			mcp.DefaultString("mysql"),
+			mcp.Description("数据库驱动"),
+			mcp.Enum(DriverNames()...),
+		)(t)
+		mcp.WithString("host",
+			mcp.DefaultString("localhost"),
+			mcp.Description("数据库主机"),
+		)(t)
+		mcp.WithNumber("port",
+			mcp.Description("数据库端口，默认为驱动的标准端口"),
+		)(t)
+		mcp.WithString("database",
+			mcp.Description("数据库名，sqlite驱动为数据库文件路径"),
+		)(t)
+		mcp.WithString("username",
+			mcp.Description("用户名"),
+		)(t)
+		mcp.WithString("password",
+			mcp.Description("密码"),
+		)(t)
+		mcp.WithString("dsn",
+			mcp.Description("完整DSN，设置后忽略host/port等参数"),
+		)(t)
+		mcp.WithNumber("query_timeout_ms",
+			mcp.Description("单次查询的最长执行时间(毫秒)，默认使用全局配置"),
+		)(t)
+		mcp.WithNumber("confirm_threshold",
+			mcp.Description("写操作影响的记录数超过该值时需要用户确认，默认不需要确认"),
+		)(t)
+		mcp.WithString("confirm_operations",
+			mcp.Description("需要确认的操作，逗号分隔，可选 insert/update/delete，默认 update,delete"),
+		)(t)
+		mcp.WithBoolean("read_only",
+			mcp.Description("只读连接：拒绝写操作，并以只读会话连接数据库"),
+		)(t)
+		mcp.WithString("allowed_tables",
+			mcp.Description("只允许访问的表，逗号分隔，默认不限"),
+		)(t)
+		mcp.WithString("denied_tables",
+			mcp.Description("禁止访问的表，逗号分隔"),
+		)(t)
+		mcp.WithNumber("max_estimated_rows",
+			mcp.Description("执行前用 EXPLAIN 检查，某张表估计扫描的行数超过该值时拒绝或请求确认，默认不检查"),
+		)(t)
+		mcp.WithNumber("max_full_scan_rows",
+			mcp.Description("全表扫描的表估计行数超过该值时拒绝或请求确认，默认不检查"),
+		)(t)
+		mcp.WithString("cost_action",
+			mcp.Description("查询代价超过阈值时的处理方式: reject(拒绝，默认) 或 confirm(请用户确认)"),
+			mcp.Enum("reject", "confirm"),
+		)(t)
+	}
+}
+
+// 从工具参数构造数据库配置
+func databaseConfigFromRequest(request mcp.CallToolRequest) DatabaseConfig {
+	return DatabaseConfig{
+		Driver:   request.GetString("driver", "mysql"),
+		Host:     request.GetString("host", "localhost"),
+		Port:     request.GetInt("port", 0),
+		Database: request.GetString("database", ""),
+		Username: request.GetString("username", ""),
+		Password: request.GetString("password", ""),
+		DSN:      request.GetString("dsn", ""),
+
+		QueryTimeout:      Duration(time.Duration(request.GetInt("query_timeout_ms", 0)) * time.Millisecond),
+		ConfirmThreshold:  int64(request.GetInt("confirm_threshold", 0)),
+		ConfirmOperations: splitList(request.GetString("confirm_operations", "")),
+		ReadOnly:          request.GetBool("read_only", false),
+		AllowedTables:     splitList(request.GetString("allowed_tables", "")),
+		DeniedTables:      splitList(request.GetString("denied_tables", "")),
+		MaxEstimatedRows:  int64(request.GetInt("max_estimated_rows", 0)),
+		MaxFullScanRows:   int64(request.GetInt("max_full_scan_rows", 0)),
+		CostAction:        request.GetString("cost_action", ""),
+	}
+}
+
+// 从工具参数构造运行时添加的连接配置，SQLite 数据库文件限制在 runtime_connections.sqlite_dir 目录下
+func runtimeDatabaseConfig(request mcp.CallToolRequest) (DatabaseConfig, error) {
+	config := databaseConfigFromRequest(request)
+	driver, err := LookupDriver(config.Driver)
+	if err != nil || driver.Name != "sqlite" {
+		return config, err
+	}
+	if config.DSN != "" {
+		return config, fmt.Errorf("SQLite 连接不能指定dsn，请用database参数指定数据库文件")
+	}
+	if config.Database == "" {
+		return config, fmt.Errorf("必须指定database参数")
+	}
+	config.Database, err = sqlitePath(config.Database)
+	return config, err
+}
+
+// 把 SQLite 数据库文件解析为 sqlite_dir 目录下的绝对路径，路径(含符号链接)指向目录之外时报错
+func sqlitePath(database string) (string, error) {
+	if database == ":memory:" {
+		return database, nil
+	}
+	dir := appConfig.RuntimeConnections.SQLiteDir
+	if dir == "" {
+		return "", fmt.Errorf("未配置 runtime_connections.sqlite_dir，运行时只能添加 :memory: SQLite 数据库")
+	}
+	if strings.HasPrefix(database, "file:") || strings.ContainsAny(database, "?#") {
+		return "", fmt.Errorf("SQLite 数据库文件 %q 不能使用URI或查询参数", database)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", fmt.Errorf("runtime_connections.sqlite_dir 不可用: %v", err)
+	}
+
+	path := database
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	// 数据库文件可能尚不存在，只解析所在目录的符号链接；文件已存在时解析文件本身
+	parent, err := filepath.EvalSymlinks(filepath.Dir(filepath.Clean(path)))
+	if err != nil {
+		return "", fmt.Errorf("SQLite 数据库文件 %q 所在的目录不存在", database)
+	}
+	path = filepath.Join(parent, filepath.Base(path))
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("SQLite 数据库文件 %q 必须位于 runtime_connections.sqlite_dir 目录下", database)
+	}
+	return path, nil
+}
+
+// 配置文件或环境变量中定义的连接，运行时不能断开或重新定义，以免绕过其只读和表访问限制
+func configuredConnection(name string) bool {
+	_, ok := appConfig.Connections[name]
+	return ok
+}
+
+// 判断请求中是否给出了连接配置
+func hasDatabaseConfigArgs(request mcp.CallToolRequest) bool {
+	args := request.GetArguments()
+	for _, key := range []string{"dsn", "database", "username", "host"} {
+		if _, ok := args[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func handleDBConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := authorizeConnection(ctx, name); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if configuredConnection(name) {
+		return mcp.NewToolResultError(fmt.Sprintf("连接 %s 在配置文件中定义，不能在运行时重新定义", name)), nil
+	}
+
+	config, err := runtimeDatabaseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if config.DSN == "" && config.Database == "" {
+		return mcp.NewToolResultError("必须指定dsn或database参数"), nil
+	}
+
+	if err := dbManager.AddConnection(name, config); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("数据库连接 %s 添加成功", name)), nil
+}
+
+func handleDBDisconnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := authorizeConnection(ctx, name); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if configuredConnection(name) {
+		return mcp.NewToolResultError(fmt.Sprintf("连接 %s 在配置文件中定义，不能断开", name)), nil
+	}
+	if connection, _ := auditLog.tableLocation(); connection == name {
+		return mcp.NewToolResultError(fmt.Sprintf("连接 %s 用于写入审计日志，不能断开", name)), nil
+	}
+
+	if err := dbManager.RemoveConnection(name); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("数据库连接 %s 已断开", name)), nil
+}
+
+func handleDBListConnections(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// 只列出当前客户端有权使用的连接
+	var infos []ConnectionInfo
+	for _, info := range dbManager.ListConnections() {
+		if connectionVisible(ctx, info.Name) {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) == 0 {
+		return mcp.NewToolResultText("当前没有数据库连接"), nil
+	}
+
+	jsonData, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("共有 %d 个数据库连接：\n%s", len(infos), string(jsonData))), nil
+}
+
+func handleDBTestConnection(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name := request.GetString("name", "")
+	start := time.Now()
+
+	if name != "" {
+		if err := authorizeConnection(ctx, name); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := dbManager.PingConnection(ctx, name); err != nil {
+			return databaseErrorResult(err), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("数据库连接 %s 正常，耗时 %s", name, time.Since(start).Round(time.Millisecond))), nil
+	}
+
+	if !hasDatabaseConfigArgs(request) {
+		return mcp.NewToolResultError("必须指定name或连接配置参数"), nil
+	}
+
+	// 使用临时管理器测试配置，测试完成后立即关闭
+	config, err := runtimeDatabaseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	tmp := NewDatabaseManager(dbManager.logLevel)
+	if err := tmp.AddConnection("test", config); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer tmp.RemoveConnection("test")
+
+	return mcp.NewToolResultText(fmt.Sprintf("数据库配置可用，耗时 %s", time.Since(start).Round(time.Millisecond))), nil
+}
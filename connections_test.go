@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestSQLitePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := appConfig
+	appConfig = DefaultConfig()
+	t.Cleanup(func() { appConfig = previous })
+
+	appConfig.RuntimeConnections.SQLiteDir = ""
+	if _, err := sqlitePath("a.db"); err == nil || !strings.Contains(err.Error(), "未配置 runtime_connections.sqlite_dir") {
+		t.Fatalf("未配置目录时 sqlitePath(a.db) 的错误 = %v", err)
+	}
+	if path, err := sqlitePath(":memory:"); err != nil || path != ":memory:" {
+		t.Fatalf("sqlitePath(:memory:) = %q, %v", path, err)
+	}
+
+	appConfig.RuntimeConnections.SQLiteDir = dir
+	tests := []struct {
+		database string
+		want     string
+		wantErr  string
+	}{
+		{"a.db", filepath.Join(root, "a.db"), ""},
+		{"sub/b.db", filepath.Join(root, "sub", "b.db"), ""},
+		{filepath.Join(dir, "c.db"), filepath.Join(root, "c.db"), ""},
+		{"sub/../d.db", filepath.Join(root, "d.db"), ""},
+		{"../x.db", "", "必须位于"},
+		{"/etc/passwd", "", "必须位于"},
+		{"link/e.db", "", "必须位于"},
+		{"missing/f.db", "", "所在的目录不存在"},
+		{".", "", "必须位于"},
+		{"file:a.db?mode=rwc", "", "不能使用URI"},
+		{"a.db?_pragma=query_only(0)", "", "不能使用URI"},
+	}
+	for _, tt := range tests {
+		got, err := sqlitePath(tt.database)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("sqlitePath(%q) 的错误 = %v，应包含 %q", tt.database, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("sqlitePath(%q) = %s, %v，期望 %s", tt.database, got, err, tt.want)
+		}
+	}
+}
+
+func TestConfiguredConnectionsAreProtected(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{ReadOnly: true})
+	tests := []struct {
+		name      string
+		handler   server.ToolHandlerFunc
+		arguments map[string]interface{}
+		wantErr   string
+	}{
+		{"disconnect", handleDBDisconnect, map[string]interface{}{"name": "default"}, "不能断开"},
+		{"redefine", handleDBConnect, map[string]interface{}{"name": "default", "driver": "sqlite", "database": ":memory:"}, "不能在运行时重新定义"},
+		{"sqlite file without directory", handleDBConnect, map[string]interface{}{"name": "scratch", "driver": "sqlite", "database": "/tmp/scratch.db"}, "sqlite_dir"},
+		{"sqlite dsn", handleDBTestConnection, map[string]interface{}{"driver": "sqlite", "dsn": "file:/etc/passwd"}, "不能指定dsn"},
+		{"memory database", handleDBConnect, map[string]interface{}{"name": "scratch", "driver": "sqlite", "database": ":memory:"}, ""},
+		{"disconnect runtime connection", handleDBDisconnect, map[string]interface{}{"name": "scratch"}, ""},
+	}
+	for _, tt := range tests {
+		result, err := tt.handler(context.Background(), newTestRequest(tt.name, tt.arguments))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := resultText(result)
+		switch {
+		case tt.wantErr == "" && result.IsError:
+			t.Errorf("%s: 意外的错误 %s", tt.name, text)
+		case tt.wantErr != "" && (!result.IsError || !strings.Contains(text, tt.wantErr)):
+			t.Errorf("%s: 结果 %q 应为包含 %q 的错误", tt.name, text, tt.wantErr)
+		}
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"root:p@ss@tcp(localhost:3306)/db", "root:******@tcp(localhost:3306)/db"},
+		{"reader:s3cret@tcp(db:3306)/app?charset=utf8mb4&parseTime=True", "reader:******@tcp(db:3306)/app?charset=utf8mb4&parseTime=True"},
+		{"root@tcp(localhost:3306)/db", "root@tcp(localhost:3306)/db"},
+		{"postgres://app:p@ss@db:5432/app?sslmode=disable", "postgres://app:******@db:5432/app?sslmode=disable"},
+		{"postgres://app@db:5432/app", "postgres://app@db:5432/app"},
+		{"sqlserver://sa:P%40ss@db:1433?database=app", "sqlserver://sa:******@db:1433?database=app"},
+		{"host=db user=app password=s3cret dbname=app", "host=db user=app password=****** dbname=app"},
+		{"/var/lib/app.db", "/var/lib/app.db"},
+	}
+	for _, tt := range tests {
+		if got := redactDSN(tt.dsn); got != tt.want {
+			t.Errorf("redactDSN(%q) = %q，期望 %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+)
+
+// 查询的估计代价超过阈值时的处理方式
+const (
+	costActionReject  = "reject"  // 拒绝执行
+	costActionConfirm = "confirm" // 请用户确认后执行
+)
+
+// CostLimitError 查询的执行计划超过了连接的代价阈值
+type CostLimitError struct {
+	Database string
+	Reasons  []string    // 每张超出阈值的表各一条原因
+	Fragment []PlanTable // 执行计划中超出阈值的表访问
+	Rows     int64       // 超出阈值的表访问中最大的估计行数，无法估计时为0
+}
+
+func (e *CostLimitError) Error() string {
+	fragment, _ := json.Marshal(e.Fragment)
+	return fmt.Sprintf("查询的执行计划超过连接 %s 的代价限制：%s；执行计划片段: %s", e.Database, strings.Join(e.Reasons, "；"), fragment)
+}
+
+func (e *CostLimitError) connection() string {
+	return e.Database
+}
+
+func (e *CostLimitError) choice() string {
+	return "选中后将执行该查询"
+}
+
+func (e *CostLimitError) record(claims *confirmClaims) {
+	rows := e.Rows
+	claims.Cost = &rows
+}
+
+// 校验连接的代价检查配置
+func (c DatabaseConfig) validateCost() error {
+	if c.MaxEstimatedRows < 0 || c.MaxFullScanRows < 0 {
+		return fmt.Errorf("max_estimated_rows 和 max_full_scan_rows 不能为负数")
+	}
+	switch strings.ToLower(c.CostAction) {
+	case "", costActionReject, costActionConfirm:
+	default:
+		return fmt.Errorf("cost_action: 不支持的处理方式 %q，可选值: reject, confirm", c.CostAction)
+	}
+	if c.MaxEstimatedRows == 0 && c.MaxFullScanRows == 0 {
+		return nil
+	}
+	// 驱动名无效时由驱动校验报错
+	if driver, err := LookupDriver(c.Driver); err == nil && (driver.ExplainPrefix == "" || driver.ParsePlan == nil) {
+		return fmt.Errorf("%s 不支持分析执行计划，不能设置 max_estimated_rows 或 max_full_scan_rows", driver.DisplayName)
+	}
+	return nil
+}
+
+// costGuard 按连接配置在执行前用 EXPLAIN 检查查询的估计代价
+type costGuard struct {
+	database    string
+	maxRows     int64
+	maxFullScan int64
+	confirm     bool
+	confirmed   *int64 // 用户已确认的估计行数，未确认时为nil
+}
+
+func newCostGuard(database string, config DatabaseConfig) *costGuard {
+	return &costGuard{
+		database:    database,
+		maxRows:     config.MaxEstimatedRows,
+		maxFullScan: config.MaxFullScanRows,
+		confirm:     strings.EqualFold(config.CostAction, costActionConfirm),
+	}
+}
+
+// 该查询是否需要检查：只检查原始SQL和结构化select
+func (g *costGuard) applies(queryType, operation string) bool {
+	if g.maxRows == 0 && g.maxFullScan == 0 {
+		return false
+	}
+	return queryType == "raw" || (queryType == "structured" && strings.EqualFold(operation, "select"))
+}
+
+// 执行计划超过阈值且超过已确认的估计行数时返回 *CostLimitError
+func (g *costGuard) check(plan *QueryPlan) error {
+	need := &CostLimitError{Database: g.database}
+	for _, table := range plan.Tables {
+		var reason string
+		switch {
+		case g.maxRows > 0 && table.EstimatedRows != nil && *table.EstimatedRows > g.maxRows:
+			reason = fmt.Sprintf("表 %s 估计扫描 %d 行，超过 max_estimated_rows=%d", table.Table, *table.EstimatedRows, g.maxRows)
+		case g.maxFullScan > 0 && table.FullScan && table.EstimatedRows == nil:
+			reason = fmt.Sprintf("表 %s 全表扫描，%s 不提供估计行数，无法确认不超过 max_full_scan_rows=%d", table.Table, plan.Dialect, g.maxFullScan)
+		case g.maxFullScan > 0 && table.FullScan && *table.EstimatedRows > g.maxFullScan:
+			reason = fmt.Sprintf("表 %s 全表扫描，估计扫描 %d 行，超过 max_full_scan_rows=%d", table.Table, *table.EstimatedRows, g.maxFullScan)
+		default:
+			continue
+		}
+		need.Reasons = append(need.Reasons, reason)
+		need.Fragment = append(need.Fragment, table)
+		if table.EstimatedRows != nil {
+			need.Rows = max(need.Rows, *table.EstimatedRows)
+		}
+	}
+	if len(need.Reasons) == 0 || (g.confirmed != nil && need.Rows <= *g.confirmed) {
+		return nil
+	}
+	return need
+}
+
+// 分析将要执行的查询，返回nil表示不需要检查(如原始SQL不是SELECT)
+func (g *costGuard) plan(db *gorm.DB, queryType string, request mcp.CallToolRequest, policy *accessPolicy) (*QueryPlan, error) {
+	if queryType != "raw" {
+		return explainStructuredSelect(db, request, policy)
+	}
+	// SHOW、DESCRIBE 等语句没有执行计划，由 executeRawQuery 照常检查
+	query := request.GetString("query", "")
+	if checkExplainableQuery(query, db.Dialector.Name()) != nil {
+		return nil, nil
+	}
+	return explainRawQuery(db, query, policy)
+}
+
+// 读取并校验请求中的 confirm_token，有效时记下已确认的估计行数
+func (g *costGuard) acceptToken(ctx context.Context, tool string, request mcp.CallToolRequest) error {
+	claims, err := acceptConfirmToken(ctx, tool, g.database, request)
+	if err != nil {
+		return err
+	}
+	g.confirmed = claims.Cost
+	return nil
+}
+
+// cost_action 为 reject 时返回的错误信息
+func (e *CostLimitError) rejected() string {
+	return e.Error() + "。已拒绝执行，可以增加过滤条件或为条件中的列建立索引，用 explain_query 查看完整的执行计划和优化建议"
+}
+
+// 执行前检查 database_query 的查询代价，超过阈值时拒绝或请求确认；返回非nil时直接作为工具结果
+func checkQueryCost(ctx context.Context, db *gorm.DB, timeout time.Duration, queryType string, request mcp.CallToolRequest, policy *accessPolicy, guard *costGuard) *mcp.CallToolResult {
+	if err := guard.acceptToken(ctx, "database_query", request); err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	var plan *QueryPlan
+	err := runQuery(ctx, db, timeout, func(tx *gorm.DB) error {
+		var err error
+		plan, err = guard.plan(tx, queryType, request, policy)
+		return err
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	if plan == nil {
+		return nil
+	}
+
+	var need *CostLimitError
+	if !errors.As(guard.check(plan), &need) {
+		return nil
+	}
+	if !guard.confirm {
+		return mcp.NewToolResultError(need.rejected())
+	}
+	if denied := requestConfirmation(ctx, "database_query", request.GetArguments(), need, confirmClaims{}); denied != nil {
+		return denied
+	}
+	// 记下已确认的估计行数，翻页时随游标带到之后的页
+	guard.confirmed = &need.Rows
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfirmTokenCarriesCost(t *testing.T) {
+	ctx := context.Background()
+	cost := int64(120000)
+	token, err := issueConfirmToken(ctx, "database_query", "default", nil, confirmClaims{Cost: &cost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifyConfirmToken(ctx, "database_query", "default", map[string]interface{}{}, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Cost == nil || *claims.Cost != cost {
+		t.Fatalf("令牌中的估计行数 = %v，期望 %d", claims.Cost, cost)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+// DatabaseDriver 描述一种数据库驱动：如何构造DSN、如何打开gorm方言，以及gorm迁移器不提供的元数据查询
+type DatabaseDriver struct {
+	Name         string
+	DisplayName  string
+	DefaultPort  int
+	MaxOpenConns int // 0 表示使用默认连接池大小
+	BuildDSN     func(config DatabaseConfig) string
+	Open         func(dsn string) gorm.Dialector
+	// 改写DSN，使连接池中的每个会话都是只读的；nil 表示驱动不支持，只读只在应用层检查
+	ReadOnlyDSN func(dsn string) (string, error)
+	// 生成执行计划：加在SELECT语句之前的EXPLAIN，以及解析其结果的函数；为空表示不支持 explain_query
+	ExplainPrefix string
+	ParsePlan     func(rows []map[string]interface{}) (*QueryPlan, error)
+	// 原始查询中禁止调用的函数(小写函数名到原因)；为 nil 表示不支持原始SQL
+	SideEffectFunctions map[string]string
+
+	// 列出服务器上的数据库，返回 name 列
+	ListDatabasesQuery string
+	// 列出表(参数为表名)的外键，返回 name, column_name, referenced_table, referenced_column 列
+	ForeignKeysQuery string
+}
+
+var databaseDrivers = make(map[string]DatabaseDriver)
+
+// 驱动别名
+var driverAliases = map[string]string{
+	"postgresql": "postgres",
+	"pg":         "postgres",
+	"sqlite3":    "sqlite",
+	"mssql":      "sqlserver",
+}
+
+func init() {
+	RegisterDriver(DatabaseDriver{
+		Name:        "mysql",
+		DisplayName: "MySQL",
+		DefaultPort: 3306,
+		BuildDSN: func(config DatabaseConfig) string {
+			return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+				config.Username, config.Password, config.Host, config.Port, config.Database)
+		},
+		Open: mysql.Open,
+		// 驱动在每个新连接上执行 SET transaction_read_only=1，即 SET SESSION TRANSACTION READ ONLY
+		ReadOnlyDSN: func(dsn string) (string, error) {
+			config, err := mysqldriver.ParseDSN(dsn)
+			if err != nil {
+				return "", err
+			}
+			if config.Params == nil {
+				config.Params = make(map[string]string)
+			}
+			config.Params["transaction_read_only"] = "1"
+			return config.FormatDSN(), nil
+		},
+		ExplainPrefix:       "EXPLAIN FORMAT=JSON",
+		ParsePlan:           parseMySQLPlan,
+		SideEffectFunctions: mysqlSideEffectFunctions,
+		ListDatabasesQuery:  "SELECT SCHEMA_NAME AS name FROM information_schema.SCHEMATA ORDER BY SCHEMA_NAME",
+		ForeignKeysQuery: `SELECT CONSTRAINT_NAME AS name, COLUMN_NAME AS column_name,
+	REFERENCED_TABLE_NAME AS referenced_table, REFERENCED_COLUMN_NAME AS referenced_column
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`,
+	})
+
+	RegisterDriver(DatabaseDriver{
+		Name:        "postgres",
+		DisplayName: "PostgreSQL",
+		DefaultPort: 5432,
+		BuildDSN: func(config DatabaseConfig) string {
+			return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+				config.Host, config.Port, config.Username, config.Password, config.Database)
+		},
+		Open: postgres.Open,
+		// 作为启动参数发送，等同于 SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY
+		ReadOnlyDSN: func(dsn string) (string, error) {
+			if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+				return appendQueryParam(dsn, "default_transaction_read_only", "on")
+			}
+			return dsn + " default_transaction_read_only=on", nil
+		},
+		ExplainPrefix:       "EXPLAIN (FORMAT JSON)",
+		ParsePlan:           parsePostgresPlan,
+		SideEffectFunctions: postgresSideEffectFunctions,
+		ListDatabasesQuery:  "SELECT datname AS name FROM pg_database WHERE NOT datistemplate ORDER BY datname",
+		ForeignKeysQuery: `SELECT con.conname AS name, att.attname AS column_name,
+	ref.relname AS referenced_table, ratt.attname AS referenced_column
+FROM pg_constraint con
+JOIN pg_class rel ON rel.oid = con.conrelid
+JOIN pg_namespace ns ON ns.oid = rel.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) AS k(col, refcol)
+JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.col
+JOIN pg_class ref ON ref.oid = con.confrelid
+JOIN pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = k.refcol
+WHERE con.contype = 'f' AND rel.relname = ? AND ns.nspname = current_schema()
+ORDER BY con.conname`,
+	})
+
+	// SQLite 使用纯Go实现，无需CGO；Database 为数据库文件路径
+	RegisterDriver(DatabaseDriver{
+		Name:         "sqlite",
+		DisplayName:  "SQLite",
+		MaxOpenConns: 1,
+		BuildDSN: func(config DatabaseConfig) string {
+			return config.Database
+		},
+		Open: sqlite.Open,
+		// 驱动在每个新连接上执行 PRAGMA query_only(1)
+		ReadOnlyDSN: func(dsn string) (string, error) {
+			return appendQueryParam(dsn, "_pragma", "query_only(1)")
+		},
+		ExplainPrefix:       "EXPLAIN QUERY PLAN",
+		ParsePlan:           parseSQLitePlan,
+		SideEffectFunctions: sqliteSideEffectFunctions,
+		ListDatabasesQuery:  "SELECT name FROM pragma_database_list ORDER BY seq",
+		ForeignKeysQuery: `SELECT 'fk_' || id AS name, "from" AS column_name,
+	"table" AS referenced_table, "to" AS referenced_column
+FROM pragma_foreign_key_list(?)
+ORDER BY id, seq`,
+	})
+
+	RegisterDriver(DatabaseDriver{
+		Name:        "sqlserver",
+		DisplayName: "SQL Server",
+		DefaultPort: 1433,
+		BuildDSN: func(config DatabaseConfig) string {
+			u := url.URL{
+				Scheme:   "sqlserver",
+				User:     url.UserPassword(config.Username, config.Password),
+				Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
+				RawQuery: url.Values{"database": {config.Database}}.Encode(),
+			}
+			return u.String()
+		},
+		Open: sqlserver.Open,
+		// 执行计划需要在单独的批次中 SET SHOWPLAN_XML ON，不支持 explain_query
+		SideEffectFunctions: sqlserverSideEffectFunctions,
+		ListDatabasesQuery:  "SELECT name FROM sys.databases ORDER BY name",
+		ForeignKeysQuery: `SELECT fk.name AS name, pc.name AS column_name,
+	rt.name AS referenced_table, rc.name AS referenced_column
+FROM sys.foreign_keys fk
+JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+JOIN sys.tables pt ON pt.object_id = fkc.parent_object_id
+JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+JOIN sys.tables rt ON rt.object_id = fkc.referenced_object_id
+JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+WHERE pt.name = ?
+ORDER BY fk.name, fkc.constraint_column_id`,
+	})
+}
+
+// 在DSN的查询串中追加参数
+func appendQueryParam(dsn, key, value string) (string, error) {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + url.Values{key: {value}}.Encode(), nil
+}
+
+// RegisterDriver 注册数据库驱动，同名驱动会被覆盖
+func RegisterDriver(driver DatabaseDriver) {
+	databaseDrivers[driver.Name] = driver
+}
+
+// LookupDriver 按名称(支持别名)查找数据库驱动，名称为空时使用mysql
+func LookupDriver(name string) (DatabaseDriver, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "mysql"
+	}
+	if alias, ok := driverAliases[name]; ok {
+		name = alias
+	}
+
+	driver, ok := databaseDrivers[name]
+	if !ok {
+		return DatabaseDriver{}, fmt.Errorf("不支持的数据库驱动: %s，可用驱动: %s", name, strings.Join(DriverNames(), ", "))
+	}
+	return driver, nil
+}
+
+// DriverNames 返回已注册的驱动名称
+func DriverNames() []string {
+	names := make([]string, 0, len(databaseDrivers))
+	for name := range databaseDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 返回连接所用驱动的显示名称
+func dialectDisplayName(db *gorm.DB) string {
+	if driver, err := LookupDriver(db.Dialector.Name()); err == nil {
+		return driver.DisplayName
+	}
+	return db.Dialector.Name()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupDriver(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"", "mysql", ""},
+		{"MySQL", "mysql", ""},
+		{" postgresql ", "postgres", ""},
+		{"pg", "postgres", ""},
+		{"sqlite3", "sqlite", ""},
+		{"mssql", "sqlserver", ""},
+		{"oracle", "", "不支持的数据库驱动: oracle"},
+	}
+	for _, tt := range tests {
+		driver, err := LookupDriver(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LookupDriver(%q) 的错误 = %v，应包含 %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || driver.Name != tt.want {
+			t.Errorf("LookupDriver(%q) = %q, %v，期望 %q", tt.name, driver.Name, err, tt.want)
+		}
+	}
+}
+
+func TestSQLiteConnection(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	if name := dialectDisplayName(db); name != "SQLite" {
+		t.Fatalf("dialectDisplayName = %s，期望 SQLite", name)
+	}
+	if err := db.Exec("UPDATE orders SET amount = amount + 1 WHERE user_id = 1").Error; err != nil {
+		t.Fatalf("可写连接更新失败: %v", err)
+	}
+	if count := countTestRows(t, "users", "deleted_at IS NULL"); count != 3 {
+		t.Fatalf("示例用户数 = %d，期望 3", count)
+	}
+}
+
+func TestSQLiteReadOnlyConnection(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{ReadOnly: true})
+	if err := db.Exec("DELETE FROM orders").Error; err == nil {
+		t.Fatal("只读连接上的 DELETE 应当失败")
+	}
+	if count := countTestRows(t, "orders", "1 = 1"); count != 3 {
+		t.Fatalf("订单数 = %d，期望 3", count)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
@@ -12,17 +15,27 @@ import (
 )
 
 // MCP 客户端示例
-// 用法: go run examples/client_demo.go
+// 用法: go run client_demo.go                                   # 以stdio方式启动本地服务器
+//
+//	go run client_demo.go -url http://localhost:8080/mcp      # 连接streamable HTTP服务器
+//	go run client_demo.go -url http://localhost:8080/mcp/sse  # 连接SSE服务器
 func main() {
+	serverURL := flag.String("url", os.Getenv("MCP_SERVER_URL"), "MCP服务器地址，为空时以stdio方式启动本地服务器")
+	token := flag.String("token", os.Getenv("MCP_SERVER_TOKEN"), "服务器启用认证时使用的token")
+	flag.Parse()
+
 	// 创建上下文
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// 创建 stdio 传输，连接到服务器
-	stdioTransport := transport.NewStdio("go", nil, "run", "../main.go")
+	// 创建传输，连接到服务器
+	clientTransport, err := newDemoTransport(*serverURL, *token)
+	if err != nil {
+		log.Fatalf("创建传输失败: %v", err)
+	}
 
 	// 创建客户端
-	c := client.NewClient(stdioTransport)
+	c := client.NewClient(clientTransport)
 
 	// 启动客户端
 	if err := c.Start(ctx); err != nil {
@@ -58,6 +71,23 @@ func main() {
 	fmt.Println("客户端演示完成")
 }
 
+// 根据服务器地址选择传输：以 /sse 结尾的地址使用SSE，其他地址使用streamable HTTP
+func newDemoTransport(serverURL, token string) (transport.Interface, error) {
+	headers := make(map[string]string)
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	switch {
+	case serverURL == "":
+		return transport.NewStdio("go", nil, "run", ".."), nil
+	case strings.HasSuffix(serverURL, "/sse"):
+		return transport.NewSSE(serverURL, transport.WithHeaders(headers))
+	default:
+		return transport.NewStreamableHTTP(serverURL, transport.WithHTTPHeaders(headers))
+	}
+}
+
 func demonstratCalculateTools(ctx context.Context, c *client.Client, serverInfo *mcp.InitializeResult) {
 	if serverInfo.Capabilities.Tools == nil {
 		fmt.Println("服务器不支持工具")
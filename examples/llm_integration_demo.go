@@ -101,30 +101,15 @@ type ToolAnalysis struct {
 
 // 初始化智能助手
 func NewIntelligentAssistant() (*IntelligentAssistant, error) {
-	// 设置自定义命令函数，指定工作目录
-	cmdFunc := func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
-		cmd := exec.CommandContext(ctx, command, args...)
-		cmd.Env = env
-		// 设置工作目录为上级目录
-		cmd.Dir = "../"
-		return cmd, nil
-	}
-
-	// 连接到MCP服务器，使用自定义命令函数
-	mcpClient, err := client.NewStdioMCPClientWithOptions(
-		"go",
-		nil,                        // env
-		[]string{"run", "main.go"}, // 修改为直接运行 main.go
-		transport.WithCommandFunc(cmdFunc),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("连接MCP服务器失败: %v", err)
-	}
-
 	// 增加超时时间到30秒，给服务器更多启动时间
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	mcpClient, err := connectMCPServer(ctx, os.Getenv("MCP_SERVER_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("连接MCP服务器失败: %v", err)
+	}
+
 	// 初始化连接
 	initRequest := mcp.InitializeRequest{
 		Params: mcp.InitializeParams{
@@ -162,6 +147,47 @@ func NewIntelligentAssistant() (*IntelligentAssistant, error) {
 	}, nil
 }
 
+// 连接MCP服务器：设置了 MCP_SERVER_URL 时连接共享的HTTP/SSE服务器(MCP_SERVER_TOKEN 为认证token)，否则在上级目录以stdio方式启动服务器
+func connectMCPServer(ctx context.Context, serverURL string) (*client.Client, error) {
+	if serverURL == "" {
+		// 设置自定义命令函数，指定工作目录
+		cmdFunc := func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+			cmd := exec.CommandContext(ctx, command, args...)
+			cmd.Env = env
+			// 设置工作目录为上级目录
+			cmd.Dir = "../"
+			return cmd, nil
+		}
+
+		return client.NewStdioMCPClientWithOptions(
+			"go",
+			nil,                  // env
+			[]string{"run", "."}, // 在上级目录中运行服务器
+			transport.WithCommandFunc(cmdFunc),
+		)
+	}
+
+	headers := make(map[string]string)
+	if token := os.Getenv("MCP_SERVER_TOKEN"); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	var mcpClient *client.Client
+	var err error
+	if strings.HasSuffix(serverURL, "/sse") {
+		mcpClient, err = client.NewSSEMCPClient(serverURL, transport.WithHeaders(headers))
+	} else {
+		mcpClient, err = client.NewStreamableHttpClient(serverURL, transport.WithHTTPHeaders(headers))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := mcpClient.Start(ctx); err != nil {
+		return nil, err
+	}
+	return mcpClient, nil
+}
+
 // 处理用户查询的主要方法
 func (ia *IntelligentAssistant) ProcessUserQuery(ctx context.Context, userQuery string) (*QueryResult, error) {
 	startTime := time.Now()
@@ -20,11 +20,11 @@ echo ""
 
 # 检查MCP服务器是否运行
 echo "🔍 检查MCP服务器状态..."
-if pgrep -f "go run.*main.go" > /dev/null; then
+if pgrep -f "mcp-demo-server|go run \." > /dev/null; then
     echo "✅ MCP服务器正在运行"
 else
     echo "❌ MCP服务器未运行，正在启动..."
-    cd .. && go run main.go &
+    cd .. && go run . &
     sleep 3
     echo "✅ MCP服务器已启动"
 fi
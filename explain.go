@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 估计扫描行数达到该值的全表扫描才单独提示
+const largeScanRows = 1000
+
+// QueryPlan explain_query 的结果：解析后的执行计划和优化建议
+type QueryPlan struct {
+	Database       string      `json:"database"`
+	Dialect        string      `json:"dialect" jsonschema:"description=数据库类型，如 MySQL、PostgreSQL、SQLite"`
+	SQL            string      `json:"sql" jsonschema:"description=分析的查询，参数已代入，仅供阅读"`
+	Tables         []PlanTable `json:"tables" jsonschema:"description=执行计划中对各表的访问，按计划中出现的顺序"`
+	UsingFilesort  bool        `json:"using_filesort" jsonschema:"description=是否需要额外的排序步骤(MySQL filesort、PostgreSQL Sort 节点、SQLite TEMP B-TREE FOR ORDER BY)"`
+	UsingTemporary bool        `json:"using_temporary" jsonschema:"description=是否使用临时表(MySQL temporary table、PostgreSQL HashAggregate/Materialize、SQLite TEMP B-TREE FOR GROUP BY/DISTINCT)"`
+	Suggestions    []string    `json:"suggestions" jsonschema:"description=基于执行计划和已有索引的优化建议"`
+	Plan           interface{} `json:"plan" jsonschema:"description=数据库返回的原始执行计划"`
+}
+
+// PlanTable 执行计划中对一张表的访问
+type PlanTable struct {
+	Table         string   `json:"table"`
+	AccessType    string   `json:"access_type" jsonschema:"description=访问方式，如 MySQL 的 ALL/ref/range、PostgreSQL 的 Seq Scan/Index Scan、SQLite 的 SCAN/SEARCH"`
+	FullScan      bool     `json:"full_scan" jsonschema:"description=是否全表扫描"`
+	EstimatedRows *int64   `json:"estimated_rows,omitempty" jsonschema:"description=估计扫描的行数，SQLite 不提供"`
+	PossibleKeys  []string `json:"possible_keys,omitempty" jsonschema:"description=可用的索引(仅MySQL)"`
+	Key           string   `json:"key,omitempty" jsonschema:"description=实际使用的索引"`
+	Condition     string   `json:"condition,omitempty" jsonschema:"description=在这张表上应用的条件"`
+}
+
+// 注册执行计划工具
+func registerExplainTools(s *server.MCPServer) {
+	explainTool := mcp.NewTool("explain_query",
+		mcp.WithDescription("分析查询的执行计划而不执行查询：返回每张表的访问方式、估计行数、可用和实际使用的索引、是否需要额外排序或临时表，以及缺失索引等优化建议。"+
+			"结构化查询与 database_query 的 select 使用相同的参数和构建方式"),
+		mcp.WithString("database",
+			mcp.DefaultString("default"),
+			mcp.Description("数据库连接名称"),
+		),
+		mcp.WithString("query_type",
+			mcp.DefaultString("raw"),
+			mcp.Description("查询类型: raw(原始SQL), structured(结构化查询)"),
+			mcp.Enum("raw", "structured"),
+		),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("raw类型为单条SELECT语句(不带EXPLAIN)，structured类型为 select"),
+		),
+		mcp.WithString("table_name",
+			mcp.Description("表名(structured查询必需)"),
+		),
+		mcp.WithString("fields",
+			mcp.DefaultString("*"),
+			mcp.Description("要查询的字段，格式同 database_query"),
+		),
+		mcp.WithString("where_conditions",
+			mcp.Description("WHERE条件，格式同 database_query"),
+		),
+		mcp.WithString("order_by",
+			mcp.Description("排序字段，格式：field1 ASC,field2 DESC"),
+		),
+		mcp.WithString("group_by",
+			mcp.Description("分组字段"),
+		),
+		mcp.WithString("having",
+			mcp.Description("HAVING条件，格式同 database_query"),
+		),
+		mcp.WithString("join_tables",
+			mcp.Description("关联表信息，格式同 database_query"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("限制返回记录数"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("偏移量"),
+		),
+		mcp.WithBoolean("include_deleted",
+			mcp.Description("包含已软删除的记录"),
+		),
+		mcp.WithNumber("timeout_ms",
+			mcp.Description("超时时间(毫秒)，不能超过连接配置的上限"),
+		),
+		mcp.WithOutputSchema[QueryPlan](),
+	)
+	addTool(s, explainTool, handleExplainQuery)
+}
+
+func handleExplainQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	queryType := request.GetString("query_type", "raw")
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	database := request.GetString("database", "default")
+
+	operation := "raw"
+	switch queryType {
+	case "raw":
+	case "structured":
+		if !strings.EqualFold(query, "select") {
+			return mcp.NewToolResultError("structured 类型只能分析 select 查询"), nil
+		}
+		operation = "select"
+	default:
+		return mcp.NewToolResultError("不支持的查询类型: " + queryType), nil
+	}
+	if err := authorizeQuery(ctx, database, operation); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	timeoutMs := request.GetInt("timeout_ms", 0)
+	if timeoutMs < 0 {
+		return mcp.NewToolResultError("timeout_ms 不能为负数"), nil
+	}
+
+	db, err := dbManager.GetConnection(database)
+	if err != nil {
+		return databaseErrorResult(err), nil
+	}
+	config, err := dbManager.ConnectionConfig(database)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	policy := newAccessPolicy(database, config)
+
+	var plan *QueryPlan
+	err = runQuery(ctx, db, queryTimeout(config, timeoutMs), func(tx *gorm.DB) error {
+		var err error
+		if queryType == "raw" {
+			plan, err = explainRawQuery(tx, query, policy)
+		} else {
+			plan, err = explainStructuredSelect(tx, request, policy)
+		}
+		if err != nil {
+			return err
+		}
+		plan.Suggestions = suggestIndexes(tx, plan)
+		return nil
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	plan.Database = database
+	return mcp.NewToolResultStructured(plan, plan.text()), nil
+}
+
+// 分析原始SELECT语句的执行计划
+func explainRawQuery(db *gorm.DB, query string, policy *accessPolicy) (*QueryPlan, error) {
+	if err := checkExplainableQuery(query, db.Dialector.Name()); err != nil {
+		return nil, err
+	}
+	if err := policy.checkRawQuery(query, db.Dialector.Name()); err != nil {
+		return nil, auditDenied(db.Statement.Context, err)
+	}
+	driver, err := explainDriver(db)
+	if err != nil {
+		return nil, err
+	}
+	return explain(driver, db.Raw(driver.ExplainPrefix+" "+query), query)
+}
+
+// 分析结构化SELECT的执行计划，查询由 buildStructuredSelect 构建，与 database_query 执行的完全相同
+func explainStructuredSelect(db *gorm.DB, request mcp.CallToolRequest, policy *accessPolicy) (*QueryPlan, error) {
+	tableName := request.GetString("table_name", "")
+	if tableName == "" {
+		return nil, fmt.Errorf("结构化查询必须指定table_name参数")
+	}
+	if err := policy.checkStructured("select", tableName, request.GetString("join_tables", "")); err != nil {
+		return nil, auditDenied(db.Statement.Context, err)
+	}
+	driver, err := explainDriver(db)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := buildStructuredSelect(db, request)
+	if err != nil {
+		return nil, err
+	}
+	if limit := request.GetInt("limit", 0); limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset := request.GetInt("offset", 0); offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	dryRun := query.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{})
+	if dryRun.Error != nil {
+		return nil, dryRun.Error
+	}
+	sql := db.Dialector.Explain(dryRun.Statement.SQL.String(), dryRun.Statement.Vars...)
+	return explain(driver, query.Clauses(explainPrefix(driver.ExplainPrefix)), sql)
+}
+
+// explainPrefix 把 EXPLAIN 加在查询的SELECT子句之前，执行计划与实际查询使用同样的SQL和绑定参数
+type explainPrefix string
+
+func (explainPrefix) Name() string {
+	return "SELECT"
+}
+
+func (e explainPrefix) Build(builder clause.Builder) {
+	builder.WriteString(string(e))
+}
+
+func (e explainPrefix) MergeClause(c *clause.Clause) {
+	c.BeforeExpression = e
+}
+
+func explainDriver(db *gorm.DB) (DatabaseDriver, error) {
+	driver, err := LookupDriver(db.Dialector.Name())
+	if err != nil {
+		return DatabaseDriver{}, err
+	}
+	if driver.ExplainPrefix == "" || driver.ParsePlan == nil {
+		return DatabaseDriver{}, fmt.Errorf("%s 不支持 explain_query", driver.DisplayName)
+	}
+	return driver, nil
+}
+
+// 执行 EXPLAIN 并解析结果，sql 为展示和分析用的查询文本；优化建议由调用方按需生成
+func explain(driver DatabaseDriver, query *gorm.DB, sql string) (*QueryPlan, error) {
+	_, rows, _, err := findPage(query, 0, pageRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("生成执行计划失败: %v", err)
+	}
+	plan, err := driver.ParsePlan(rows)
+	if err != nil {
+		return nil, fmt.Errorf("解析执行计划失败: %v", err)
+	}
+	plan.Dialect = driver.DisplayName
+	plan.SQL = sql
+	if plan.Tables == nil {
+		plan.Tables = []PlanTable{}
+	}
+	return plan, nil
+}
+
+// 按执行计划和已有索引给出建议：全表扫描的表上缺少索引的过滤列、未使用的索引、额外排序和临时表
+func suggestIndexes(db *gorm.DB, plan *QueryPlan) []string {
+	suggestions := []string{}
+	filters, aliases, _ := filterColumns(plan.SQL, db.Dialector.Name())
+
+	for _, table := range plan.Tables {
+		if len(table.PossibleKeys) > 0 && table.Key == "" {
+			suggestions = append(suggestions, fmt.Sprintf("表 %s 有可用的索引 %s，但优化器没有使用，可能是条件的选择性太低", table.Table, strings.Join(table.PossibleKeys, ", ")))
+		}
+		if !table.FullScan {
+			continue
+		}
+
+		// 执行计划中的表名可能是查询里的别名
+		name := table.Table
+		if real, ok := aliases[strings.ToLower(name)]; ok {
+			name = real
+		}
+		indexed := indexedColumns(db, name)
+		var missing, unused []string
+		for _, filter := range filters {
+			if !strings.EqualFold(filter.table, name) {
+				continue
+			}
+			if indexed[strings.ToLower(filter.column)] {
+				// 驱动表上的JOIN列不需要索引，只检查WHERE中的列
+				if !filter.join {
+					unused = append(unused, filter.column)
+				}
+			} else {
+				missing = append(missing, filter.column)
+			}
+		}
+		for _, column := range missing {
+			suggestions = append(suggestions, fmt.Sprintf("表 %s 全表扫描，条件中的列 %s 没有索引，可以考虑: CREATE INDEX %s ON %s (%s)",
+				name, column, db.Statement.Quote("idx_"+name+"_"+column), db.Statement.Quote(name), db.Statement.Quote(column)))
+		}
+		if len(unused) > 0 {
+			suggestions = append(suggestions, fmt.Sprintf("表 %s 全表扫描，但条件中的列 %s 已有索引，检查条件是否对列使用了函数、隐式类型转换或以 %% 开头的 LIKE", name, strings.Join(unused, ", ")))
+		}
+		if len(missing) == 0 && len(unused) == 0 && (table.EstimatedRows == nil || *table.EstimatedRows >= largeScanRows) {
+			suggestions = append(suggestions, fmt.Sprintf("表 %s 全表扫描，查询中没有能使用索引的条件；数据量大时考虑增加过滤条件或限制返回的行数", name))
+		}
+	}
+
+	if plan.UsingFilesort {
+		suggestions = append(suggestions, "排序需要额外的排序步骤：可以为 ORDER BY 的列建立索引，或与等值条件的列组成联合索引(等值列在前)")
+	}
+	if plan.UsingTemporary {
+		suggestions = append(suggestions, "查询使用了临时表：为 GROUP BY/DISTINCT 的列建立索引可以避免")
+	}
+	return suggestions
+}
+
+// 表中作为某个索引首列的列(小写)，包括主键
+func indexedColumns(db *gorm.DB, table string) map[string]bool {
+	indexed := make(map[string]bool)
+	migrator := db.Migrator()
+	if indexes, err := migrator.GetIndexes(table); err == nil {
+		for _, index := range indexes {
+			if columns := index.Columns(); len(columns) > 0 {
+				indexed[strings.ToLower(columns[0])] = true
+			}
+		}
+	}
+	if columnTypes, err := migrator.ColumnTypes(table); err == nil {
+		for _, columnType := range columnTypes {
+			if primary, ok := columnType.PrimaryKey(); ok && primary {
+				indexed[strings.ToLower(columnType.Name())] = true
+			}
+		}
+	}
+	return indexed
+}
+
+// 文本内容：每张表的访问方式、排序和临时表，以及建议
+func (p *QueryPlan) text() string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("%s 执行计划:\nSQL: %s\n", p.Dialect, p.SQL))
+	for _, table := range p.Tables {
+		text.WriteString(fmt.Sprintf("- %s: %s", table.Table, table.AccessType))
+		if table.FullScan {
+			text.WriteString("，全表扫描")
+		}
+		if table.EstimatedRows != nil {
+			text.WriteString(fmt.Sprintf("，估计 %d 行", *table.EstimatedRows))
+		}
+		if table.Key != "" {
+			text.WriteString("，使用索引 " + table.Key)
+		}
+		if len(table.PossibleKeys) > 0 {
+			text.WriteString("，可用索引 " + strings.Join(table.PossibleKeys, ", "))
+		}
+		if table.Condition != "" {
+			text.WriteString("，条件 " + table.Condition)
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString(fmt.Sprintf("额外排序: %s，临时表: %s\n", yesNo(p.UsingFilesort), yesNo(p.UsingTemporary)))
+	if len(p.Suggestions) == 0 {
+		text.WriteString("未发现明显问题")
+		return text.String()
+	}
+	text.WriteString("建议:")
+	for i, suggestion := range p.Suggestions {
+		text.WriteString(fmt.Sprintf("\n%d. %s", i+1, suggestion))
+	}
+	return text.String()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "是"
+	}
+	return "否"
+}
+
+// EXPLAIN 结果第一行中的JSON文档；column 不存在时取唯一的一列
+func planDocument(rows []map[string]interface{}, column string) (interface{}, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("EXPLAIN 没有返回结果")
+	}
+	value, ok := rows[0][column]
+	if !ok && len(rows[0]) == 1 {
+		for _, v := range rows[0] {
+			value = v
+		}
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		return nil, fmt.Errorf("EXPLAIN 结果中没有 %s 列", column)
+	default:
+		// 驱动已解码的JSON
+		return v, nil
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// JSON中的数值转换为行数
+func planRows(value interface{}) *int64 {
+	if number, ok := value.(float64); ok {
+		rows := int64(number)
+		return &rows
+	}
+	return nil
+}
+
+func planStrings(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var values []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// 解析 MySQL/MariaDB 的 EXPLAIN FORMAT=JSON
+func parseMySQLPlan(rows []map[string]interface{}) (*QueryPlan, error) {
+	document, err := planDocument(rows, "EXPLAIN")
+	if err != nil {
+		return nil, err
+	}
+	plan := &QueryPlan{Plan: document}
+	walkMySQLPlan(document, plan)
+	return plan, nil
+}
+
+// 遍历计划中的所有节点；嵌套循环的表按数组顺序出现，同一对象内的键按名称排序以保持输出稳定
+func walkMySQLPlan(node interface{}, plan *QueryPlan) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			walkMySQLPlan(item, plan)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := v[key]
+			switch key {
+			case "table":
+				if table, ok := value.(map[string]interface{}); ok {
+					plan.Tables = append(plan.Tables, mysqlPlanTable(table))
+				}
+			case "using_filesort":
+				plan.UsingFilesort = plan.UsingFilesort || value == true
+			case "using_temporary_table":
+				plan.UsingTemporary = plan.UsingTemporary || value == true
+			case "filesort": // MariaDB
+				plan.UsingFilesort = true
+			case "temporary_table": // MariaDB
+				plan.UsingTemporary = true
+			}
+			walkMySQLPlan(value, plan)
+		}
+	}
+}
+
+func mysqlPlanTable(table map[string]interface{}) PlanTable {
+	result := PlanTable{
+		PossibleKeys: planStrings(table["possible_keys"]),
+	}
+	result.Table, _ = table["table_name"].(string)
+	result.AccessType, _ = table["access_type"].(string)
+	result.Key, _ = table["key"].(string)
+	result.Condition, _ = table["attached_condition"].(string)
+	result.FullScan = result.AccessType == "ALL"
+	// MySQL 为 rows_examined_per_scan，MariaDB 为 rows
+	result.EstimatedRows = planRows(table["rows_examined_per_scan"])
+	if result.EstimatedRows == nil {
+		result.EstimatedRows = planRows(table["rows"])
+	}
+	return result
+}
+
+// 解析 PostgreSQL 的 EXPLAIN (FORMAT JSON)
+func parsePostgresPlan(rows []map[string]interface{}) (*QueryPlan, error) {
+	document, err := planDocument(rows, "QUERY PLAN")
+	if err != nil {
+		return nil, err
+	}
+	plan := &QueryPlan{Plan: document}
+	items, _ := document.([]interface{})
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			if root, ok := object["Plan"].(map[string]interface{}); ok {
+				walkPostgresPlan(root, plan)
+			}
+		}
+	}
+	return plan, nil
+}
+
+func walkPostgresPlan(node map[string]interface{}, plan *QueryPlan) {
+	nodeType, _ := node["Node Type"].(string)
+	switch nodeType {
+	case "Sort", "Incremental Sort":
+		plan.UsingFilesort = true
+	case "Materialize", "HashAggregate":
+		plan.UsingTemporary = true
+	}
+
+	if relation, _ := node["Relation Name"].(string); relation != "" {
+		table := PlanTable{
+			Table:         relation,
+			AccessType:    nodeType,
+			FullScan:      nodeType == "Seq Scan",
+			EstimatedRows: planRows(node["Plan Rows"]),
+			Key:           postgresIndexName(node),
+		}
+		for _, key := range []string{"Index Cond", "Recheck Cond", "Filter"} {
+			if condition, _ := node[key].(string); condition != "" {
+				table.Condition = condition
+				break
+			}
+		}
+		plan.Tables = append(plan.Tables, table)
+	}
+
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if object, ok := child.(map[string]interface{}); ok {
+			walkPostgresPlan(object, plan)
+		}
+	}
+}
+
+// 节点使用的索引；Bitmap Heap Scan 的索引在子节点 Bitmap Index Scan 中
+func postgresIndexName(node map[string]interface{}) string {
+	if name, _ := node["Index Name"].(string); name != "" {
+		return name
+	}
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if object, ok := child.(map[string]interface{}); ok && object["Relation Name"] == nil {
+			if name := postgresIndexName(object); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// SQLite EXPLAIN QUERY PLAN 中的表访问，如 SCAN users、SEARCH users USING INDEX idx_users_email (email=?)
+var sqliteAccessPattern = regexp.MustCompile(`^(SCAN|SEARCH)(?: TABLE)? (\S+)(?: AS \S+)?(?: USING (.+?))?(?: \((.+)\))?$`)
+
+// SQLite 索引的名称：USING [COVERING] INDEX name 或 USING INTEGER PRIMARY KEY
+var sqliteIndexPattern = regexp.MustCompile(`INDEX (\S+)|(PRIMARY KEY)`)
+
+// 解析 SQLite 的 EXPLAIN QUERY PLAN，每行的 detail 描述一个步骤
+func parseSQLitePlan(rows []map[string]interface{}) (*QueryPlan, error) {
+	plan := &QueryPlan{Plan: rows}
+	for _, row := range rows {
+		detail, _ := row["detail"].(string)
+		switch {
+		case strings.HasPrefix(detail, "USE TEMP B-TREE FOR") && strings.Contains(detail, "ORDER BY"):
+			plan.UsingFilesort = true
+		case strings.HasPrefix(detail, "USE TEMP B-TREE FOR"):
+			plan.UsingTemporary = true
+		}
+
+		match := sqliteAccessPattern.FindStringSubmatch(detail)
+		if match == nil {
+			continue
+		}
+		table := PlanTable{Table: match[2], AccessType: match[1], Condition: match[4]}
+		if index := sqliteIndexPattern.FindStringSubmatch(match[3]); index != nil {
+			table.Key = index[1] + index[2]
+		}
+		table.FullScan = table.AccessType == "SCAN" && table.Key == ""
+		plan.Tables = append(plan.Tables, table)
+	}
+	return plan, nil
+}
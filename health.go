@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const healthResourceURI = "health://server"
+
+var serverStartedAt = time.Now()
+
+// DatabaseUnavailableError 数据库连接当前不可用
+type DatabaseUnavailableError struct {
+	Connection string    `json:"connection"`
+	Status     string    `json:"status"`
+	Cause      string    `json:"cause"`
+	RetryAt    time.Time `json:"retry_at"`
+}
+
+func (e *DatabaseUnavailableError) Error() string {
+	msg := fmt.Sprintf("数据库连接 %s 当前不可用: %s", e.Connection, e.Cause)
+	if wait := time.Until(e.RetryAt); wait > 0 {
+		msg += fmt.Sprintf("，%s 后可重试", wait.Round(time.Second))
+	}
+	return msg
+}
+
+// ServerHealth 服务器健康状态
+type ServerHealth struct {
+	Status      string             `json:"status"`
+	StartedAt   time.Time          `json:"started_at"`
+	Uptime      string             `json:"uptime"`
+	Connections []ConnectionHealth `json:"connections"`
+}
+
+// ConnectionHealth 单个数据库连接的状态
+type ConnectionHealth struct {
+	Name        string     `json:"name"`
+	Driver      string     `json:"driver"`
+	Status      string     `json:"status"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+	Failures    int        `json:"consecutive_failures"`
+	NextRetry   *time.Time `json:"next_retry,omitempty"`
+	Pool        *PoolStats `json:"pool,omitempty"`
+}
+
+// PoolStats 连接池统计，来自 sql.DB.Stats()
+type PoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+// Health 汇总 visible 返回 true 的连接的状态(visible 为nil时汇总所有连接)；
+// ping为true时对其中已连接的连接执行一次ping并更新状态
+func (dm *DatabaseManager) Health(ctx context.Context, ping bool, visible func(name string) bool) ServerHealth {
+	dm.mutex.RLock()
+	conns := make([]*managedConnection, 0, len(dm.connections))
+	for _, conn := range dm.connections {
+		if visible == nil || visible(conn.name) {
+			conns = append(conns, conn)
+		}
+	}
+	dm.mutex.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].name < conns[j].name
+	})
+
+	health := ServerHealth{
+		Status:      "ok",
+		StartedAt:   serverStartedAt,
+		Uptime:      time.Since(serverStartedAt).Round(time.Second).String(),
+		Connections: make([]ConnectionHealth, 0, len(conns)),
+	}
+	for _, conn := range conns {
+		if ping {
+			conn.ping(ctx)
+		}
+		connHealth := conn.health()
+		if connHealth.Status == connectionFailed || connHealth.Status == connectionUnhealthy {
+			health.Status = "degraded"
+		}
+		health.Connections = append(health.Connections, connHealth)
+	}
+	return health
+}
+
+// 对已建立的连接执行ping并记录结果
+func (c *managedConnection) ping(ctx context.Context) {
+	c.mu.Lock()
+	db := c.db
+	c.mu.Unlock()
+	if db == nil {
+		return
+	}
+
+	err := errors.New("无法获取底层连接")
+	if sqlDB, dbErr := db.DB(); dbErr == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt = time.Now()
+	if err != nil {
+		c.status = connectionUnhealthy
+		c.lastError = err.Error()
+		return
+	}
+	c.status = connectionConnected
+	c.lastError = ""
+}
+
+func (c *managedConnection) health() ConnectionHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := ConnectionHealth{
+		Name:      c.name,
+		Driver:    c.config.Driver,
+		Status:    c.status,
+		LastError: c.lastError,
+		Failures:  c.failures,
+	}
+	if !c.lastAttempt.IsZero() {
+		t := c.lastAttempt
+		h.LastAttempt = &t
+	}
+	if !c.connectedAt.IsZero() {
+		t := c.connectedAt
+		h.ConnectedAt = &t
+	}
+	if c.nextRetry.After(time.Now()) {
+		t := c.nextRetry
+		h.NextRetry = &t
+	}
+
+	if c.db != nil {
+		if sqlDB, err := c.db.DB(); err == nil {
+			stats := sqlDB.Stats()
+			h.Pool = &PoolStats{
+				MaxOpenConnections: stats.MaxOpenConnections,
+				OpenConnections:    stats.OpenConnections,
+				InUse:              stats.InUse,
+				Idle:               stats.Idle,
+				WaitCount:          stats.WaitCount,
+				WaitDuration:       stats.WaitDuration.String(),
+				MaxIdleClosed:      stats.MaxIdleClosed,
+				MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+				MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+			}
+		}
+	}
+	return h
+}
+
+// 将数据库错误转换为工具错误结果，连接不可用时返回结构化的JSON错误
+func databaseErrorResult(err error) *mcp.CallToolResult {
+	var unavailable *DatabaseUnavailableError
+	if !errors.As(err, &unavailable) {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	payload := map[string]interface{}{
+		"error":      "database_unavailable",
+		"message":    unavailable.Error(),
+		"connection": unavailable.Connection,
+		"status":     unavailable.Status,
+		"cause":      unavailable.Cause,
+	}
+	if wait := time.Until(unavailable.RetryAt); wait > 0 {
+		payload["retry_after_ms"] = wait.Milliseconds()
+	}
+
+	jsonData, jsonErr := json.MarshalIndent(payload, "", "  ")
+	if jsonErr != nil {
+		return mcp.NewToolResultError(unavailable.Error())
+	}
+	return mcp.NewToolResultError(string(jsonData))
+}
+
+// 注册健康检查工具和资源
+func registerHealthTools(s *server.MCPServer) {
+	healthTool := mcp.NewTool("server_health",
+		mcp.WithDescription("查看服务器和各数据库连接的健康状态、连接池统计和最近一次错误"),
+		mcp.WithBoolean("ping",
+			mcp.DefaultBool(false),
+			mcp.Description("是否对已建立的连接执行一次ping"),
+		),
+	)
+	addTool(s, healthTool, handleServerHealth)
+
+	healthResource := mcp.NewResource(healthResourceURI, "server_health",
+		mcp.WithResourceDescription("服务器和各数据库连接的健康状态"),
+		mcp.WithMIMEType("application/json"),
+	)
+	s.AddResource(healthResource, handleHealthResource)
+}
+
+// 只包含当前客户端有权使用的连接
+func visibleConnections(ctx context.Context) func(name string) bool {
+	return func(name string) bool {
+		return connectionVisible(ctx, name)
+	}
+}
+
+func handleServerHealth(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	health := dbManager.Health(ctx, request.GetBool("ping", false), visibleConnections(ctx))
+
+	jsonData, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func handleHealthResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	health := dbManager.Health(ctx, false, visibleConnections(ctx))
+
+	jsonData, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      healthResourceURI,
+			MIMEType: "application/json",
+			Text:     string(jsonData),
+		},
+	}, nil
+}
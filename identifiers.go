@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 标识符：字母或下划线开头，由字母、数字、下划线组成
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 聚合函数：COUNT(*)、COUNT(DISTINCT col)、SUM(col) 等
+var aggregatePattern = regexp.MustCompile(`(?i)^(count|sum|avg|min|max)\s*\(\s*(distinct\s+)?([^()]*?)\s*\)$`)
+
+// 字段别名：expr AS alias
+var aliasPattern = regexp.MustCompile(`(?i)^(.+?)\s+as\s+(\S+)$`)
+
+// 允许的JOIN类型
+var joinTypes = map[string]string{
+	"":      "INNER",
+	"inner": "INNER",
+	"left":  "LEFT",
+	"right": "RIGHT",
+}
+
+// queryScope 结构化查询涉及的表及其列，来自数据库的实时表结构；
+// 查询中出现的每个标识符都要在这里校验并按方言加引号
+type queryScope struct {
+	db          *gorm.DB
+	tables      []string
+	columns     map[string]map[string]bool // 表名 -> 小写列名
+	primaryKeys map[string][]string        // 表名 -> 主键列，按表中的顺序
+	aliases     map[string]string          // 小写别名 -> 加引号的别名
+	numeric     map[string]bool            // 结果为数值的聚合函数(COUNT、SUM、AVG)的小写别名
+	softDelete  string                     // 主表属于软删除模型时为其软删除列
+}
+
+func newQueryScope(db *gorm.DB, table string) (*queryScope, error) {
+	scope := &queryScope{
+		db:          db,
+		columns:     make(map[string]map[string]bool),
+		primaryKeys: make(map[string][]string),
+		aliases:     make(map[string]string),
+		numeric:     make(map[string]bool),
+	}
+	if err := scope.addTable(table); err != nil {
+		return nil, err
+	}
+	if column := softDeleteColumn(db, table); scope.columns[table][strings.ToLower(column)] {
+		scope.softDelete = column
+	}
+	return scope, nil
+}
+
+// 把表加入查询并读取它的列
+func (s *queryScope) addTable(table string) error {
+	if !identifierPattern.MatchString(table) {
+		return fmt.Errorf("无效的表名 %q", table)
+	}
+	if _, ok := s.columns[table]; ok {
+		return nil
+	}
+	if !s.db.Migrator().HasTable(table) {
+		return fmt.Errorf("表 %s 不存在", table)
+	}
+
+	columnTypes, err := s.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return fmt.Errorf("读取表 %s 的结构失败: %v", table, err)
+	}
+	columns := make(map[string]bool, len(columnTypes))
+	var primaryKey []string
+	for _, columnType := range columnTypes {
+		columns[strings.ToLower(columnType.Name())] = true
+		if isPrimary, ok := columnType.PrimaryKey(); ok && isPrimary {
+			primaryKey = append(primaryKey, columnType.Name())
+		}
+	}
+	s.tables = append(s.tables, table)
+	s.columns[table] = columns
+	s.primaryKeys[table] = primaryKey
+	return nil
+}
+
+// 只保留表中列出的列，其余列在查询中视为不存在
+func (s *queryScope) restrictColumns(table string, allowed []string) {
+	columns := make(map[string]bool, len(allowed))
+	for _, column := range allowed {
+		column = strings.ToLower(column)
+		if s.columns[table][column] {
+			columns[column] = true
+		}
+	}
+	s.columns[table] = columns
+}
+
+func (s *queryScope) quote(name string) string {
+	return s.db.Statement.Quote(name)
+}
+
+// 主表名，已校验过；传给 db.Table 时由gorm加引号
+func (s *queryScope) table() string {
+	return s.tables[0]
+}
+
+// 主表的主键列，驱动无法提供时为空
+func (s *queryScope) primaryKey() []string {
+	return s.primaryKeys[s.table()]
+}
+
+// 校验列引用(column 或 table.column)并返回加引号的形式
+func (s *queryScope) column(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	table, column, qualified := strings.Cut(ref, ".")
+	if !qualified {
+		table, column = "", table
+	}
+	if !identifierPattern.MatchString(column) || (qualified && !identifierPattern.MatchString(table)) {
+		return "", fmt.Errorf("无效的列名 %q", ref)
+	}
+
+	if qualified {
+		columns, ok := s.columns[table]
+		if !ok {
+			return "", fmt.Errorf("表 %s 不在查询中，可用的表: %s", table, strings.Join(s.tables, ", "))
+		}
+		if !columns[strings.ToLower(column)] {
+			return "", fmt.Errorf("表 %s 没有列 %s", table, column)
+		}
+		return s.quote(table) + "." + s.quote(column), nil
+	}
+
+	for _, table := range s.tables {
+		if s.columns[table][strings.ToLower(column)] {
+			return s.quote(column), nil
+		}
+	}
+	return "", fmt.Errorf("列 %s 不存在于表 %s", column, strings.Join(s.tables, ", "))
+}
+
+// 校验聚合函数表达式，如 COUNT(*)、SUM(orders.amount)
+func (s *queryScope) aggregate(expr string) (string, bool, error) {
+	match := aggregatePattern.FindStringSubmatch(strings.TrimSpace(expr))
+	if match == nil {
+		return "", false, nil
+	}
+
+	function := strings.ToUpper(match[1])
+	distinct := ""
+	if match[2] != "" {
+		distinct = "DISTINCT "
+	}
+	if match[3] == "*" {
+		if function != "COUNT" || distinct != "" {
+			return "", true, fmt.Errorf("只有 COUNT 可以使用 *: %q", expr)
+		}
+		return "COUNT(*)", true, nil
+	}
+
+	column, err := s.column(match[3])
+	if err != nil {
+		return "", true, err
+	}
+	return fmt.Sprintf("%s(%s%s)", function, distinct, column), true, nil
+}
+
+// 校验条件或排序中引用的表达式：列、select中定义的别名，allowAggregate时还可以是聚合函数
+func (s *queryScope) expression(expr string, allowAggregate bool) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if quoted, ok := s.aliases[strings.ToLower(expr)]; ok {
+		return quoted, nil
+	}
+	if sql, ok, err := s.aggregate(expr); ok {
+		if !allowAggregate {
+			return "", fmt.Errorf("此处不能使用聚合函数: %q", expr)
+		}
+		return sql, err
+	}
+	return s.column(expr)
+}
+
+// 表达式是否为结果总是数值的聚合函数，或select中这类聚合函数的别名；MIN、MAX 的结果类型随列而定
+func (s *queryScope) numericExpression(expr string) bool {
+	expr = strings.TrimSpace(expr)
+	if _, ok := s.aliases[strings.ToLower(expr)]; ok {
+		return s.numeric[strings.ToLower(expr)]
+	}
+	return numericAggregate(expr)
+}
+
+func numericAggregate(expr string) bool {
+	match := aggregatePattern.FindStringSubmatch(strings.TrimSpace(expr))
+	if match == nil {
+		return false
+	}
+	switch strings.ToLower(match[1]) {
+	case "count", "sum", "avg":
+		return true
+	}
+	return false
+}
+
+// 解析逗号分隔的查询字段：*、table.*、列、聚合函数，均可带 AS 别名
+func (s *queryScope) selectList(fields string) (string, error) {
+	var parts []string
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		alias := ""
+		if match := aliasPattern.FindStringSubmatch(field); match != nil {
+			field, alias = strings.TrimSpace(match[1]), match[2]
+			if !identifierPattern.MatchString(alias) {
+				return "", fmt.Errorf("无效的别名 %q", alias)
+			}
+		}
+
+		var sql string
+		switch {
+		case field == "*":
+			sql = "*"
+		case strings.HasSuffix(field, ".*"):
+			table := strings.TrimSuffix(field, ".*")
+			if _, ok := s.columns[table]; !ok {
+				return "", fmt.Errorf("表 %s 不在查询中，可用的表: %s", table, strings.Join(s.tables, ", "))
+			}
+			sql = s.quote(table) + ".*"
+		default:
+			aggregate, ok, err := s.aggregate(field)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				sql = aggregate
+			} else if sql, err = s.column(field); err != nil {
+				return "", err
+			}
+		}
+
+		if alias != "" {
+			if sql == "*" || strings.HasSuffix(sql, ".*") {
+				return "", fmt.Errorf("%s 不能使用别名", field)
+			}
+			quoted := s.quote(alias)
+			s.aliases[strings.ToLower(alias)] = quoted
+			s.numeric[strings.ToLower(alias)] = numericAggregate(field)
+			sql += " AS " + quoted
+		}
+		parts = append(parts, sql)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("fields 不能为空")
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// 解析逗号分隔的分组列
+func (s *queryScope) columnList(list string) (string, error) {
+	var parts []string
+	for _, ref := range strings.Split(list, ",") {
+		if strings.TrimSpace(ref) == "" {
+			continue
+		}
+		column, err := s.column(ref)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, column)
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// 解析ORDER BY：列或别名，方向只能是 ASC 或 DESC
+func (s *queryScope) orderBy(orderBy string) (string, error) {
+	var parts []string
+	for _, item := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return "", fmt.Errorf("无效的排序项 %q，格式: field [ASC|DESC]", strings.TrimSpace(item))
+		}
+
+		expr, err := s.expression(fields[0], true)
+		if err != nil {
+			return "", err
+		}
+		if len(fields) == 2 {
+			direction := strings.ToUpper(fields[1])
+			if direction != "ASC" && direction != "DESC" {
+				return "", fmt.Errorf("无效的排序方向 %q，只能是 ASC 或 DESC", fields[1])
+			}
+			expr += " " + direction
+		}
+		parts = append(parts, expr)
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// 解析JOIN：表必须存在，类型只能是 INNER/LEFT/RIGHT，ON 条件为列与列的等值比较，
+// 可写成 "users.id=orders.user_id" (多个条件用逗号分隔) 或 {"users.id":"orders.user_id"}
+func (s *queryScope) join(joinType, table string, on interface{}) (string, error) {
+	sqlType, ok := joinTypes[strings.ToLower(strings.TrimSpace(joinType))]
+	if !ok {
+		return "", fmt.Errorf("不支持的JOIN类型 %q，可选值: INNER, LEFT, RIGHT", joinType)
+	}
+	if err := s.addTable(table); err != nil {
+		return "", err
+	}
+
+	// 同一列可以出现在多个条件中，按书写顺序保留每个条件
+	var pairs [][2]string
+	switch v := on.(type) {
+	case string:
+		for _, condition := range strings.Split(v, ",") {
+			if strings.TrimSpace(condition) == "" {
+				continue
+			}
+			left, right, ok := strings.Cut(condition, "=")
+			if !ok {
+				return "", fmt.Errorf("无效的JOIN条件 %q，格式: table1.column=table2.column", strings.TrimSpace(condition))
+			}
+			pairs = append(pairs, [2]string{strings.TrimSpace(left), strings.TrimSpace(right)})
+		}
+	case map[string]interface{}:
+		lefts := make([]string, 0, len(v))
+		for left := range v {
+			lefts = append(lefts, left)
+		}
+		sort.Strings(lefts)
+		for _, left := range lefts {
+			rightRef, ok := v[left].(string)
+			if !ok {
+				return "", fmt.Errorf("JOIN条件 %s 的值必须是列名", left)
+			}
+			pairs = append(pairs, [2]string{left, rightRef})
+		}
+	default:
+		return "", fmt.Errorf("JOIN %s 必须指定on条件", table)
+	}
+	if len(pairs) == 0 {
+		return "", fmt.Errorf("JOIN %s 必须指定on条件", table)
+	}
+
+	conditions := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		leftColumn, err := s.column(pair[0])
+		if err != nil {
+			return "", err
+		}
+		rightColumn, err := s.column(pair[1])
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, leftColumn+" = "+rightColumn)
+	}
+	return fmt.Sprintf("%s JOIN %s ON %s", sqlType, s.quote(table), strings.Join(conditions, " AND ")), nil
+}
+
+// joinSpec join_tables 参数中的一项
+type joinSpec struct {
+	Table string      `json:"table"`
+	On    interface{} `json:"on"`
+	Type  string      `json:"type"`
+}
+
+// 解析join_tables参数：[{"table":"orders","on":"users.id=orders.user_id","type":"LEFT"}]
+func parseJoinTables(joinTables string) ([]joinSpec, error) {
+	var joins []joinSpec
+	if err := json.Unmarshal([]byte(joinTables), &joins); err != nil {
+		return nil, fmt.Errorf("join_tables参数格式错误，必须是JSON数组: %v", err)
+	}
+	return joins, nil
+}
+
+// join_tables 中引用的表名
+func joinTableNames(joinTables string) ([]string, error) {
+	joins, err := parseJoinTables(joinTables)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(joins))
+	for _, join := range joins {
+		names = append(names, join.Table)
+	}
+	return names, nil
+}
+
+// 把join_tables中的表加入scope并生成JOIN子句
+func (s *queryScope) joins(joinTables string) ([]string, error) {
+	joins, err := parseJoinTables(joinTables)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := make([]string, 0, len(joins))
+	for _, join := range joins {
+		clause, err := s.join(join.Type, join.Table, join.On)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// 校验要写入的列都存在于主表中
+func (s *queryScope) writableColumns(data map[string]interface{}) error {
+	for key := range data {
+		if strings.Contains(key, ".") {
+			return fmt.Errorf("写入的列名不能带表名: %q", key)
+		}
+		if _, err := s.column(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewQueryScopeTableNames(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	tests := []struct {
+		table   string
+		wantErr string
+	}{
+		{"users", ""},
+		{"orders", ""},
+		{"missing", "表 missing 不存在"},
+		{"main.users", "无效的表名"},
+		{"users; DROP TABLE users", "无效的表名"},
+		{"`users`", "无效的表名"},
+		{"", "无效的表名"},
+	}
+	for _, tt := range tests {
+		if _, err := newQueryScope(db, tt.table); !errorMatches(err, tt.wantErr) {
+			t.Errorf("newQueryScope(%q) 的错误 = %v，期望 %q", tt.table, err, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryScopeIdentifiers(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	scope, err := newQueryScope(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"name", "`name`", ""},
+		{" Email ", "`Email`", ""},
+		{"users.id", "`users`.`id`", ""},
+		{"users.missing", "", "表 users 没有列 missing"},
+		{"orders.id", "", "表 orders 不在查询中"},
+		{"name)", "", "无效的列名"},
+		{"users.id.x", "", "无效的列名"},
+		{"1=1 OR name", "", "无效的列名"},
+	}
+	for _, tt := range columns {
+		got, err := scope.column(tt.ref)
+		if !errorMatches(err, tt.wantErr) || got != tt.want {
+			t.Errorf("column(%q) = %q, %v，期望 %q, %q", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	selects := []struct {
+		fields  string
+		want    string
+		wantErr string
+	}{
+		{"*", "*", ""},
+		{"id, name AS user_name", "`id`, `name` AS `user_name`", ""},
+		{"users.*, COUNT(DISTINCT status) AS total", "`users`.*, COUNT(DISTINCT `status`) AS `total`", ""},
+		{"COUNT(*) total", "", "无效的列名"},
+		{"SUM(*)", "", "只有 COUNT 可以使用 *"},
+		{"name AS `x`", "", "无效的别名"},
+		{"users.* AS u", "", "不能使用别名"},
+		{"orders.*", "", "表 orders 不在查询中"},
+		{"LOWER(name)", "", "无效的列名"},
+		{" , ", "", "fields 不能为空"},
+	}
+	for _, tt := range selects {
+		got, err := scope.selectList(tt.fields)
+		if !errorMatches(err, tt.wantErr) || got != tt.want {
+			t.Errorf("selectList(%q) = %q, %v，期望 %q, %q", tt.fields, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// 排序可以引用 select 中定义的别名
+	orders := []struct {
+		orderBy string
+		want    string
+		wantErr string
+	}{
+		{"user_name desc, id", "`user_name` DESC, `id`", ""},
+		{"COUNT(*) ASC", "COUNT(*) ASC", ""},
+		{"id;DROP", "", "无效的列名"},
+		{"id; DROP TABLE users", "", "无效的排序项"},
+		{"id sideways", "", "无效的排序方向"},
+		{"id asc nulls", "", "无效的排序项"},
+	}
+	for _, tt := range orders {
+		got, err := scope.orderBy(tt.orderBy)
+		if !errorMatches(err, tt.wantErr) || got != tt.want {
+			t.Errorf("orderBy(%q) = %q, %v，期望 %q, %q", tt.orderBy, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryScopeJoins(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	tests := []struct {
+		name       string
+		joinTables string
+		want       []string
+		wantErr    string
+	}{
+		{
+			name:       "string condition",
+			joinTables: `[{"table":"orders","on":"users.id=orders.user_id"}]`,
+			want:       []string{"INNER JOIN `orders` ON `users`.`id` = `orders`.`user_id`"},
+		},
+		{
+			name:       "object condition",
+			joinTables: `[{"table":"orders","on":{"orders.user_id":"users.id"},"type":"left"}]`,
+			want:       []string{"LEFT JOIN `orders` ON `orders`.`user_id` = `users`.`id`"},
+		},
+		{
+			name:       "several conditions",
+			joinTables: `[{"table":"orders","on":"users.id=orders.user_id, users.id=orders.id","type":"RIGHT"}]`,
+			want:       []string{"RIGHT JOIN `orders` ON `users`.`id` = `orders`.`user_id` AND `users`.`id` = `orders`.`id`"},
+		},
+		{name: "not an array", joinTables: `{"table":"orders"}`, wantErr: "必须是JSON数组"},
+		{name: "cross join", joinTables: `[{"table":"orders","on":"users.id=orders.user_id","type":"CROSS"}]`, wantErr: "不支持的JOIN类型"},
+		{name: "missing table", joinTables: `[{"table":"payments","on":"users.id=payments.user_id"}]`, wantErr: "表 payments 不存在"},
+		{name: "injected table", joinTables: `[{"table":"orders o","on":"users.id=o.user_id"}]`, wantErr: "无效的表名"},
+		{name: "missing on", joinTables: `[{"table":"orders"}]`, wantErr: "必须指定on条件"},
+		{name: "not an equality", joinTables: `[{"table":"orders","on":"users.id>orders.user_id"}]`, wantErr: "无效的JOIN条件"},
+		{name: "comparison injected", joinTables: `[{"table":"orders","on":"users.id=orders.user_id OR 1=1"}]`, wantErr: "无效的列名"},
+		{name: "literal on right side", joinTables: `[{"table":"orders","on":{"orders.user_id":1}}]`, wantErr: "必须是列名"},
+		{name: "unknown column", joinTables: `[{"table":"orders","on":"users.id=orders.customer_id"}]`, wantErr: "表 orders 没有列 customer_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := newQueryScope(db, "users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := scope.joins(tt.joinTables)
+			if !errorMatches(err, tt.wantErr) || strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("joins(%s) = %v, %v，期望 %v, %q", tt.joinTables, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWritableColumns(t *testing.T) {
+	db := newTestDatabase(t, DatabaseConfig{})
+	scope, err := newQueryScope(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fields  map[string]interface{}
+		wantErr string
+	}{
+		{map[string]interface{}{"name": "x", "status": "active"}, ""},
+		{map[string]interface{}{"users.name": "x"}, "不能带表名"},
+		{map[string]interface{}{"role": "admin"}, "列 role 不存在"},
+	}
+	for _, tt := range tests {
+		if err := scope.writableColumns(tt.fields); !errorMatches(err, tt.wantErr) {
+			t.Errorf("writableColumns(%v) 的错误 = %v，期望 %q", tt.fields, err, tt.wantErr)
+		}
+	}
+}
+
+// wantErr 为空时要求没有错误，否则要求错误信息包含 wantErr
+func errorMatches(err error, wantErr string) bool {
+	if err == nil || wantErr == "" {
+		return err == nil && wantErr == ""
+	}
+	return strings.Contains(err.Error(), wantErr)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 单次调用最多插入的记录数
+const maxInsertRows = 10000
+
+// 每条INSERT语句包含的记录数，默认值和上限
+const (
+	defaultInsertBatchSize = 100
+	maxInsertBatchSize     = 1000
+)
+
+// 文本内容中最多列出的主键数
+const maxTextPrimaryKeys = 20
+
+// InsertStats 批量插入和upsert的统计
+type InsertStats struct {
+	Inserted    int64                    `json:"inserted" jsonschema:"description=新插入的记录数"`
+	Updated     int64                    `json:"updated" jsonschema:"description=与已有记录冲突而被更新的记录数(on_conflict=update)"`
+	Ignored     int64                    `json:"ignored" jsonschema:"description=与已有记录冲突而被跳过的记录数(on_conflict=ignore)"`
+	Batches     int                      `json:"batches" jsonschema:"description=执行的INSERT语句数"`
+	Estimated   bool                     `json:"estimated,omitempty" jsonschema:"description=inserted和updated是否为估计值：MySQL在任一唯一索引冲突时都会更新，而执行前只按conflict_columns统计已有记录"`
+	PrimaryKeys []map[string]interface{} `json:"primary_keys,omitempty" jsonschema:"description=插入或更新的记录的主键(含自动生成的主键)，无法确定时为空"`
+}
+
+// structuredInsert 已校验的INSERT：要写入的记录和冲突处理方式
+type structuredInsert struct {
+	scope           *queryScope
+	rows            []map[string]interface{}
+	columns         []string // 写入的列，各行相同
+	onConflict      string   // 空、ignore 或 update
+	conflictColumns []string
+	updateColumns   []string
+	batchSize       int
+}
+
+// 结构化INSERT查询，fields 为一个对象或对象数组
+func executeStructuredInsert(db *gorm.DB, request mcp.CallToolRequest) (*QueryResult, error) {
+	insert, err := parseStructuredInsert(db, request)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := insert.exec(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tableName := insert.scope.table()
+	summary := fmt.Sprintf("成功向表 %s 插入 %d 条记录", tableName, stats.Inserted)
+	switch insert.onConflict {
+	case "update":
+		summary += fmt.Sprintf("，更新 %d 条已有记录", stats.Updated)
+		if stats.Estimated {
+			summary += "(按 conflict_columns 估计，其他唯一索引冲突时实际更新的记录可能更多)"
+		}
+	case "ignore":
+		summary += fmt.Sprintf("，跳过 %d 条已存在的记录", stats.Ignored)
+	}
+	result := newWriteResult("insert", tableName, stats.Inserted+stats.Updated, summary)
+	result.Insert = stats
+	return result, nil
+}
+
+func parseStructuredInsert(db *gorm.DB, request mcp.CallToolRequest) (*structuredInsert, error) {
+	tableName := request.GetString("table_name", "")
+	fields := jsonArgument(request, "fields")
+
+	if fields == "" {
+		return nil, fmt.Errorf("INSERT操作必须指定fields参数，格式：{\"field1\":\"value1\",\"field2\":\"value2\"}，批量插入时为对象数组")
+	}
+
+	var value interface{}
+	if err := decodeFields(fields, &value); err != nil {
+		return nil, fmt.Errorf("fields参数格式错误，必须是有效的JSON格式")
+	}
+	var rows []map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		rows = []map[string]interface{}{fieldValues(v)}
+	case []interface{}:
+		for i, item := range v {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("fields[%d]: 必须是对象", i)
+			}
+			rows = append(rows, fieldValues(row))
+		}
+	default:
+		return nil, fmt.Errorf("fields参数格式错误，INSERT操作必须是对象或对象数组")
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("fields 不能是空数组")
+	}
+	if len(rows) > maxInsertRows {
+		return nil, fmt.Errorf("单次最多插入 %d 条记录，收到 %d 条", maxInsertRows, len(rows))
+	}
+
+	scope, err := newQueryScope(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows[0]) == 0 {
+		return nil, fmt.Errorf("fields[0]: 至少要指定一个列")
+	}
+	if err := scope.writableColumns(rows[0]); err != nil {
+		return nil, err
+	}
+
+	// 缺少的列会被写成NULL而不是默认值，因此要求每行的列都相同
+	insert := &structuredInsert{scope: scope, rows: rows}
+	for column := range rows[0] {
+		insert.columns = append(insert.columns, column)
+	}
+	slices.Sort(insert.columns)
+	for i, row := range rows[1:] {
+		if len(row) != len(insert.columns) {
+			return nil, fmt.Errorf("fields[%d]: 每条记录的列必须与第一条相同", i+1)
+		}
+		for _, column := range insert.columns {
+			if _, ok := row[column]; !ok {
+				return nil, fmt.Errorf("fields[%d]: 缺少列 %s，每条记录的列必须与第一条相同", i+1, column)
+			}
+		}
+	}
+
+	insert.batchSize = request.GetInt("batch_size", defaultInsertBatchSize)
+	if insert.batchSize <= 0 || insert.batchSize > maxInsertBatchSize {
+		return nil, fmt.Errorf("batch_size 必须在 1 到 %d 之间", maxInsertBatchSize)
+	}
+
+	if err := insert.parseConflict(request); err != nil {
+		return nil, err
+	}
+	return insert, nil
+}
+
+// 解析冲突处理参数 on_conflict、conflict_columns 和 update_columns
+func (ins *structuredInsert) parseConflict(request mcp.CallToolRequest) error {
+	ins.onConflict = strings.ToLower(request.GetString("on_conflict", ""))
+	conflictColumns := splitList(request.GetString("conflict_columns", ""))
+	updateColumns := splitList(request.GetString("update_columns", ""))
+
+	switch ins.onConflict {
+	case "", "error":
+		ins.onConflict = ""
+		if len(conflictColumns) > 0 || len(updateColumns) > 0 {
+			return fmt.Errorf("conflict_columns 和 update_columns 需要与 on_conflict 一起使用")
+		}
+		return nil
+	case "ignore", "update":
+	default:
+		return fmt.Errorf("不支持的 on_conflict: %q，可选值: error, ignore, update", ins.onConflict)
+	}
+
+	if len(conflictColumns) == 0 {
+		return fmt.Errorf("on_conflict=%s 时必须指定 conflict_columns，即判断冲突的主键或唯一索引列", ins.onConflict)
+	}
+	for _, column := range conflictColumns {
+		if err := ins.checkInsertedColumn(column, "conflict_columns"); err != nil {
+			return err
+		}
+	}
+	ins.conflictColumns = conflictColumns
+
+	if ins.onConflict == "ignore" {
+		if len(updateColumns) > 0 {
+			return fmt.Errorf("update_columns 只能与 on_conflict=update 一起使用")
+		}
+		return nil
+	}
+
+	// 未指定时更新除冲突列和主键以外的所有写入列
+	if len(updateColumns) == 0 {
+		for _, column := range ins.columns {
+			if !containsFold(conflictColumns, column) && !containsFold(ins.scope.primaryKey(), column) {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+		if len(updateColumns) == 0 {
+			return fmt.Errorf("没有可更新的列，请指定 update_columns 或改用 on_conflict=ignore")
+		}
+	}
+	for _, column := range updateColumns {
+		if err := ins.checkInsertedColumn(column, "update_columns"); err != nil {
+			return err
+		}
+	}
+	ins.updateColumns = updateColumns
+	return nil
+}
+
+// 冲突列和更新列都必须是写入的列
+func (ins *structuredInsert) checkInsertedColumn(column, arg string) error {
+	if !slices.Contains(ins.columns, column) {
+		return fmt.Errorf("%s 中的列 %s 不在 fields 中", arg, column)
+	}
+	return nil
+}
+
+// 在一个事务中分批执行INSERT，返回插入、更新和跳过的记录数以及主键
+func (ins *structuredInsert) exec(db *gorm.DB) (*InsertStats, error) {
+	stats := &InsertStats{PrimaryKeys: []map[string]interface{}{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return ins.insertBatches(tx, stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (ins *structuredInsert) insertBatches(db *gorm.DB, stats *InsertStats) error {
+	primaryKey := ins.scope.primaryKey()
+	returning := len(primaryKey) > 0 && slices.Contains(db.Callback().Create().Clauses, "RETURNING")
+
+	for start := 0; start < len(ins.rows); start += ins.batchSize {
+		batch := ins.rows[start:min(start+ins.batchSize, len(ins.rows))]
+
+		// 写入前按冲突列统计已存在的记录，即将被更新的记录数
+		var existing int64
+		if ins.onConflict == "update" {
+			var err error
+			if existing, err = ins.countExisting(db, batch); err != nil {
+				return err
+			}
+		}
+
+		query := db.Table(ins.scope.table())
+		if ins.onConflict != "" {
+			query = query.Clauses(ins.conflictClause(db))
+		}
+		if returning {
+			columns := make([]clause.Column, len(primaryKey))
+			for i, column := range primaryKey {
+				columns[i] = clause.Column{Name: column}
+			}
+			query = query.Clauses(clause.Returning{Columns: columns})
+		}
+
+		// 使用RETURNING时返回的记录会追加在 values 后面
+		values := slices.Clone(batch)
+		result := query.Create(&values)
+		if result.Error != nil {
+			return fmt.Errorf("第 %d 批(第 %d~%d 条)插入失败: %v", stats.Batches+1, start+1, start+len(batch), result.Error)
+		}
+		stats.Batches++
+
+		switch ins.onConflict {
+		case "update":
+			// MySQL 的 ON DUPLICATE KEY UPDATE 不区分冲突的是哪个唯一索引，按冲突列统计的结果只是估计
+			stats.Estimated = db.Dialector.Name() == "mysql"
+			stats.Updated += existing
+			stats.Inserted += int64(len(batch)) - existing
+		case "ignore":
+			// 被跳过的记录不计入影响的记录数
+			stats.Inserted += result.RowsAffected
+			stats.Ignored += int64(len(batch)) - result.RowsAffected
+		default:
+			stats.Inserted += int64(len(batch))
+		}
+
+		if returning {
+			stats.PrimaryKeys = append(stats.PrimaryKeys, values[len(batch):]...)
+		} else {
+			stats.PrimaryKeys = append(stats.PrimaryKeys, ins.batchKeys(batch)...)
+		}
+	}
+	return nil
+}
+
+// 冲突处理子句；MySQL 不支持 DO NOTHING，忽略冲突时改为把冲突列赋值为自身
+func (ins *structuredInsert) conflictClause(db *gorm.DB) clause.OnConflict {
+	onConflict := clause.OnConflict{}
+	for _, column := range ins.conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	switch {
+	case ins.onConflict == "update":
+		onConflict.DoUpdates = clause.AssignmentColumns(ins.updateColumns)
+	case db.Dialector.Name() == "mysql":
+		column := clause.Column{Name: ins.conflictColumns[0]}
+		onConflict.DoUpdates = clause.Set{{Column: column, Value: column}}
+	default:
+		onConflict.DoNothing = true
+	}
+	return onConflict
+}
+
+// 统计冲突列的值与本批记录相同的已有记录数；其他驱动只在冲突列上判断冲突，MySQL 上为估计值
+func (ins *structuredInsert) countExisting(db *gorm.DB, batch []map[string]interface{}) (int64, error) {
+	conditions := make([]string, 0, len(batch))
+	var args []interface{}
+	for _, row := range batch {
+		parts := make([]string, len(ins.conflictColumns))
+		for i, column := range ins.conflictColumns {
+			parts[i] = ins.scope.quote(column) + " = ?"
+			args = append(args, row[column])
+		}
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	var count int64
+	err := db.Table(ins.scope.table()).Where(strings.Join(conditions, " OR "), args...).Count(&count).Error
+	return count, err
+}
+
+// 不支持RETURNING时的主键：记录中给出了主键时直接使用；
+// 单列自增主键在普通INSERT后由gorm按 LastInsertId 写入记录的 @id
+func (ins *structuredInsert) batchKeys(batch []map[string]interface{}) []map[string]interface{} {
+	primaryKey := ins.scope.primaryKey()
+	if len(primaryKey) == 0 {
+		return nil
+	}
+
+	keys := make([]map[string]interface{}, 0, len(batch))
+	switch {
+	case ins.onConflict != "ignore" && containsAllFold(ins.columns, primaryKey):
+		for _, row := range batch {
+			key := make(map[string]interface{}, len(primaryKey))
+			for _, column := range ins.columns {
+				if containsFold(primaryKey, column) {
+					key[column] = row[column]
+				}
+			}
+			keys = append(keys, key)
+		}
+	case ins.onConflict == "" && len(primaryKey) == 1:
+		for _, row := range batch {
+			id, ok := row["@id"]
+			if !ok {
+				return nil
+			}
+			delete(row, "@id")
+			keys = append(keys, map[string]interface{}{primaryKey[0]: id})
+		}
+	}
+	return keys
+}
+
+// 文本内容：摘要加上前几个主键
+func (s *InsertStats) text(summary string) string {
+	if len(s.PrimaryKeys) == 0 {
+		return summary
+	}
+	keys := s.PrimaryKeys
+	if len(keys) > maxTextPrimaryKeys {
+		keys = keys[:maxTextPrimaryKeys]
+	}
+	jsonData, err := json.Marshal(keys)
+	if err != nil {
+		return summary
+	}
+	text := fmt.Sprintf("%s\n主键: %s", summary, jsonData)
+	if len(s.PrimaryKeys) > len(keys) {
+		text += fmt.Sprintf(" 等共 %d 个", len(s.PrimaryKeys))
+	}
+	return text
+}
+
+// 解码 fields 参数，数字先保留为 json.Number，避免超过 2^53 的整数被 float64 舍入
+func decodeFields(fields string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(fields))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// 转换要写入的列值：能用int64表示的整数转为int64，其他数字保留原文，由数据库按列类型精确转换
+func fieldValues(row map[string]interface{}) map[string]interface{} {
+	for column, value := range row {
+		if number, ok := value.(json.Number); ok {
+			if i, err := number.Int64(); err == nil {
+				row[column] = i
+			} else {
+				row[column] = number.String()
+			}
+		}
+	}
+	return row
+}
+
+// 读取可以是JSON字符串、也可以直接写成对象或数组的参数，统一返回JSON字符串
+func jsonArgument(request mcp.CallToolRequest, key string) string {
+	switch value := request.GetArguments()[key].(type) {
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	return ""
+}
+
+func containsFold(list []string, name string) bool {
+	return slices.ContainsFunc(list, func(item string) bool { return strings.EqualFold(item, name) })
+}
+
+func containsAllFold(list, names []string) bool {
+	for _, name := range names {
+		if !containsFold(list, name) {
+			return false
+		}
+	}
+	return true
+}
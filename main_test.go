@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 创建测试用的 SQLite 数据库并注册为连接 default：已迁移所有模型并写入示例数据，
+// 另有不属于任何模型的 orders 表；测试结束后恢复全局的连接管理器和配置
+func newTestDatabase(t *testing.T, config DatabaseConfig) *gorm.DB {
+	t.Helper()
+
+	manager, previousConfig := dbManager, appConfig
+	dbManager = NewDatabaseManager(logger.Silent)
+	appConfig = DefaultConfig()
+	t.Cleanup(func() {
+		dbManager.Close()
+		dbManager, appConfig = manager, previousConfig
+	})
+
+	// 只读连接不能迁移，先用可写连接建好表和数据
+	path := filepath.Join(t.TempDir(), "test.db")
+	setup, err := openDatabase("setup", DatabaseConfig{Driver: "sqlite", Database: path}, logger.Silent)
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	migrateDatabase("setup", setup, true)
+	err = setup.Exec(`CREATE TABLE orders (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL,
+	note TEXT
+)`).Error
+	if err == nil {
+		err = setup.Exec("INSERT INTO orders (user_id, amount, note) VALUES (1, 100, 'a'), (1, 250, 'b'), (3, 80, NULL)").Error
+	}
+	if err != nil {
+		t.Fatalf("创建 orders 表失败: %v", err)
+	}
+	closeDatabase(setup)
+
+	config.Driver = "sqlite"
+	config.Database = path
+	if err := dbManager.RegisterConnection("default", config); err != nil {
+		t.Fatalf("注册测试连接失败: %v", err)
+	}
+	appConfig.Connections["default"] = config
+
+	db, err := dbManager.GetConnection("default")
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	return db
+}
+
+// 测试用的工具调用请求
+func newTestRequest(tool string, arguments map[string]interface{}) (request mcp.CallToolRequest) {
+	request.Params.Name = tool
+	request.Params.Arguments = arguments
+	return request
+}
+
+// 统计连接 default 中满足条件的记录数
+func countTestRows(t *testing.T, table, where string) int64 {
+	t.Helper()
+	db, err := dbManager.GetConnection("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := db.Table(table).Where(where).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+)
+
+// 每个模型都支持的操作，可与 where_conditions、order_by、limit、offset 组合使用
+const (
+	modelOperationList  = "list"
+	modelOperationCount = "count"
+)
+
+// ModelOperation 模型的命名操作：查询(如"活跃用户"、"最近注册的用户")或由 Execute 实现的写操作
+type ModelOperation struct {
+	Name        string
+	Description string
+	Scope       func(db *gorm.DB) *gorm.DB // 附加的条件和排序，为nil时等同于list
+	Limit       int                        // 最多返回的记录数，0 表示不限
+
+	// 设置 Execute 时由它执行操作，Scope 和 Limit 不再使用；
+	// Kind 为写入方式(insert/update/delete)，用于授权、只读连接检查和确认阈值，只读操作为空；
+	// Execute 的写操作按一条记录计入确认阈值，实际影响的记录更多时回滚
+	Execute func(db *gorm.DB, input ModelInput) (*QueryResult, error)
+	Kind    string
+}
+
+// ModelInput 自定义操作的输入：fields 为要写入的数据，where_conditions 为定位记录的等值条件
+type ModelInput struct {
+	Fields map[string]interface{}
+	Where  map[string]interface{}
+}
+
+// ModelDefinition 可通过 model 查询类型访问的模型
+type ModelDefinition struct {
+	Name        string      // model_name 参数中使用的名称
+	Description string      // 在工具说明中展示
+	Model       interface{} // gorm模型，如 &User{}；表名由gorm按模型解析
+	Operations  []ModelOperation
+	Filters     []string // 可在 where_conditions 中使用的列
+	SortFields  []string // 可在 order_by 中使用的列
+}
+
+var modelRegistry = make(map[string]ModelDefinition)
+
+// RegisterModel 注册模型，同名模型会被覆盖
+func RegisterModel(model ModelDefinition) {
+	modelRegistry[strings.ToLower(model.Name)] = model
+}
+
+// LookupModel 按名称查找已注册的模型
+func LookupModel(name string) (ModelDefinition, error) {
+	model, ok := modelRegistry[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return ModelDefinition{}, fmt.Errorf("不支持的模型查询: %s，可用模型: %s", name, strings.Join(ModelNames(), ", "))
+	}
+	return model, nil
+}
+
+// ModelNames 返回已注册的模型名称
+func ModelNames() []string {
+	names := make([]string, 0, len(modelRegistry))
+	for name := range modelRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 所有已注册模型的实例，用于自动迁移
+func registeredModels() []interface{} {
+	models := make([]interface{}, 0, len(modelRegistry))
+	for _, name := range ModelNames() {
+		models = append(models, modelRegistry[name].Model)
+	}
+	return models
+}
+
+// 模型支持的全部操作名
+func (m ModelDefinition) operationNames() []string {
+	names := []string{modelOperationList, modelOperationCount}
+	if m.softDeletes() {
+		names = append(names, modelOperationDelete, modelOperationRestore, modelOperationPurge)
+	}
+	for _, operation := range m.Operations {
+		names = append(names, operation.Name)
+	}
+	return names
+}
+
+func (m ModelDefinition) operation(name string) (ModelOperation, error) {
+	switch strings.ToLower(name) {
+	case modelOperationList, modelOperationCount:
+		return ModelOperation{Name: strings.ToLower(name)}, nil
+	case modelOperationDelete, modelOperationPurge, modelOperationRestore:
+		if m.softDeletes() {
+			kind := "delete"
+			if strings.EqualFold(name, modelOperationRestore) {
+				kind = "update"
+			}
+			return ModelOperation{Name: strings.ToLower(name), Kind: kind}, nil
+		}
+	}
+	for _, operation := range m.Operations {
+		if strings.EqualFold(operation.Name, name) {
+			return operation, nil
+		}
+	}
+	return ModelOperation{}, fmt.Errorf("模型 %s 不支持操作 %s，可用操作: %s", m.Name, name, strings.Join(m.operationNames(), ", "))
+}
+
+// 请求的模型操作会写入数据时返回其写入方式，否则返回空字符串
+func modelWriteKind(request mcp.CallToolRequest) string {
+	model, err := LookupModel(request.GetString("model_name", ""))
+	if err != nil {
+		return ""
+	}
+	operation, err := model.operation(request.GetString("query", ""))
+	if err != nil {
+		return ""
+	}
+	return operation.Kind
+}
+
+// 读取自定义操作的 fields 和 where_conditions，二者都必须是JSON对象
+func modelInput(request mcp.CallToolRequest) (ModelInput, error) {
+	input := ModelInput{Fields: map[string]interface{}{}, Where: map[string]interface{}{}}
+	for _, arg := range []struct {
+		name   string
+		target *map[string]interface{}
+	}{{"fields", &input.Fields}, {"where_conditions", &input.Where}} {
+		value := jsonArgument(request, arg.name)
+		if value == "" || value == "*" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(value), arg.target); err != nil || *arg.target == nil {
+			return input, fmt.Errorf("%s 必须是JSON对象，如 {\"email\":\"a@example.com\"}", arg.name)
+		}
+	}
+	return input, nil
+}
+
+// 模型对应的表名
+func (m ModelDefinition) table(db *gorm.DB) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m.Model); err != nil {
+		return "", fmt.Errorf("解析模型 %s 失败: %v", m.Name, err)
+	}
+	return stmt.Schema.Table, nil
+}
+
+// 工具说明中列出的模型及其操作，如 users(用户): list, count, active
+func modelCatalog() string {
+	var parts []string
+	for _, name := range ModelNames() {
+		model := modelRegistry[name]
+		label := name
+		if model.Description != "" {
+			label += "(" + model.Description + ")"
+		}
+		var reads, writes []string
+		for _, name := range model.operationNames() {
+			if operation, _ := model.operation(name); operation.Kind != "" {
+				writes = append(writes, name)
+			} else {
+				reads = append(reads, name)
+			}
+		}
+		text := fmt.Sprintf("%s: 查询 %s", label, strings.Join(reads, "/"))
+		if len(writes) > 0 {
+			text += "；写入 " + strings.Join(writes, "/")
+		}
+		parts = append(parts, fmt.Sprintf("%s；可过滤 %s；可排序 %s", text, strings.Join(model.Filters, "/"), strings.Join(model.SortFields, "/")))
+	}
+	return strings.Join(parts, "；")
+}
+
+// model 查询类型：执行模型的命名操作，where_conditions 和 order_by 只能使用模型允许的字段
+func executeModelQuery(db *gorm.DB, request mcp.CallToolRequest, page pageRequest, policy *accessPolicy) (*QueryResult, error) {
+	model, err := LookupModel(request.GetString("model_name", ""))
+	if err != nil {
+		return nil, err
+	}
+	operation, err := model.operation(request.GetString("query", ""))
+	if err != nil {
+		return nil, err
+	}
+	table, err := model.table(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.checkTables(table); err != nil {
+		return nil, auditDenied(db.Statement.Context, err)
+	}
+
+	if err := policy.checkOperation(operation.Kind); err != nil {
+		return nil, auditDenied(db.Statement.Context, err)
+	}
+	if operation.Execute != nil {
+		input, err := modelInput(request)
+		if err != nil {
+			return nil, err
+		}
+		return operation.Execute(db, input)
+	}
+
+	query, err := model.filtered(db, table, operation, request)
+	if err != nil {
+		return nil, err
+	}
+	if operation.Kind != "" {
+		// 软删除模型内置的 delete/restore/purge
+		return executeSoftDeleteOperation(db, query, model, table, operation.Name, request)
+	}
+	if request.GetBool("include_deleted", false) {
+		query = query.Unscoped()
+	}
+
+	// 调用时指定的排序优先于操作自带的排序
+	if orderBy := request.GetString("order_by", ""); orderBy != "" {
+		order, err := model.orderBy(db, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Order(order)
+	}
+	if operation.Scope != nil {
+		query = operation.Scope(query)
+	}
+
+	if operation.Name == modelOperationCount {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("查询模型 %s 的记录数失败: %v", model.Name, err)
+		}
+		return countResult(table, count, fmt.Sprintf("模型 %s 的记录数: %d", model.Name, count)), nil
+	}
+
+	limit := request.GetInt("limit", 0)
+	if operation.Limit > 0 && (limit <= 0 || limit > operation.Limit) {
+		limit = operation.Limit
+	}
+	columns, rows, more, err := findPage(page.apply(query, request.GetInt("offset", 0), limit), 0, page)
+	if err != nil {
+		return nil, fmt.Errorf("查询模型 %s 失败: %v", model.Name, err)
+	}
+
+	summary := fmt.Sprintf("模型 %s 查询成功，返回 %d 条记录：", model.Name, len(rows))
+	if len(rows) == 0 {
+		summary = fmt.Sprintf("模型 %s 查询结果为空", model.Name)
+	}
+	return newRowsResult(strings.ToLower(operation.Name), table, columns, rows, more, summary), nil
+}
+
+// 模型查询加上 where_conditions，只允许模型的可过滤字段；写操作必须指定条件
+func (m ModelDefinition) filtered(db *gorm.DB, table string, operation ModelOperation, request mcp.CallToolRequest) (*gorm.DB, error) {
+	query := db.Model(m.newModel())
+	whereConditions := request.GetString("where_conditions", "")
+	if whereConditions == "" {
+		if operation.Kind != "" {
+			return nil, fmt.Errorf("%s 操作必须指定where_conditions参数，以防止误操作所有记录", operation.Name)
+		}
+		return query, nil
+	}
+
+	scope, err := newQueryScope(db, table)
+	if err != nil {
+		return nil, err
+	}
+	scope.restrictColumns(table, m.Filters)
+	if query, err = applyWhereConditions(query, scope, whereConditions); err != nil {
+		return nil, fmt.Errorf("%v (模型 %s 可过滤的字段: %s)", err, m.Name, strings.Join(m.Filters, ", "))
+	}
+	return query, nil
+}
+
+// 估算模型写操作将影响的记录数，返回模型的表名和记录数
+func countModelWrite(db *gorm.DB, request mcp.CallToolRequest) (string, int64, error) {
+	model, err := LookupModel(request.GetString("model_name", ""))
+	if err != nil {
+		return "", 0, err
+	}
+	operation, err := model.operation(request.GetString("query", ""))
+	if err != nil {
+		return "", 0, err
+	}
+	table, err := model.table(db)
+	if err != nil {
+		return "", 0, err
+	}
+	if operation.Execute != nil {
+		return table, 1, nil
+	}
+
+	query, err := model.filtered(db, table, operation, request)
+	if err != nil {
+		return "", 0, err
+	}
+	if query, err = softDeleteTarget(db, query, model, operation.Name, request); err != nil {
+		return "", 0, err
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return "", 0, fmt.Errorf("统计模型 %s 将%s的记录数失败: %v", model.Name, writeVerb(operation.Kind), err)
+	}
+	return table, count, nil
+}
+
+// 解析 order_by，只允许模型的可排序字段
+func (m ModelDefinition) orderBy(db *gorm.DB, orderBy string) (string, error) {
+	var parts []string
+	for _, item := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return "", fmt.Errorf("无效的排序项 %q，格式: field [ASC|DESC]", strings.TrimSpace(item))
+		}
+		if !containsFold(m.SortFields, fields[0]) {
+			return "", fmt.Errorf("模型 %s 不能按 %s 排序，可排序的字段: %s", m.Name, fields[0], strings.Join(m.SortFields, ", "))
+		}
+		expr := db.Statement.Quote(strings.ToLower(fields[0]))
+		if len(fields) == 2 {
+			direction := strings.ToUpper(fields[1])
+			if direction != "ASC" && direction != "DESC" {
+				return "", fmt.Errorf("无效的排序方向 %q，只能是 ASC 或 DESC", fields[1])
+			}
+			expr += " " + direction
+		}
+		parts = append(parts, expr)
+	}
+	return strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 校验连接的只读和表访问配置
+func (c DatabaseConfig) validateAccess() error {
+	var errs []error
+	if c.ReadOnly && (c.AutoMigrate || c.SeedData) {
+		errs = append(errs, fmt.Errorf("read_only 连接不能启用 auto_migrate 或 seed_data"))
+	}
+	for _, list := range []struct {
+		name   string
+		tables []string
+	}{{"allowed_tables", c.AllowedTables}, {"denied_tables", c.DeniedTables}} {
+		for _, table := range list.tables {
+			if !identifierPattern.MatchString(table) {
+				errs = append(errs, fmt.Errorf("%s: 无效的表名 %q", list.name, table))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// accessPolicy 连接的访问策略：是否只读，以及允许和禁止访问的表
+type accessPolicy struct {
+	database string
+	readOnly bool
+	allowed  []string // 为空时允许所有表
+	denied   []string // 优先于 allowed
+}
+
+func newAccessPolicy(database string, config DatabaseConfig) *accessPolicy {
+	return &accessPolicy{
+		database: database,
+		readOnly: config.ReadOnly,
+		allowed:  config.AllowedTables,
+		denied:   config.DeniedTables,
+	}
+}
+
+// 按连接名取出访问策略，连接不存在时不做限制(由后续获取连接时报告)
+func connectionPolicy(database string) *accessPolicy {
+	config, err := dbManager.ConnectionConfig(database)
+	if err != nil {
+		return nil
+	}
+	return newAccessPolicy(database, config)
+}
+
+// 是否限制了可访问的表
+func (p *accessPolicy) restrictsTables() bool {
+	return p != nil && (len(p.allowed) > 0 || len(p.denied) > 0)
+}
+
+// 检查操作是否会写入数据，只读连接拒绝写操作
+func (p *accessPolicy) checkOperation(operation string) error {
+	if p == nil || !p.readOnly {
+		return nil
+	}
+	switch strings.ToLower(operation) {
+	case "insert", "update", "delete":
+		return fmt.Errorf("拒绝执行: 连接 %s 为只读，不允许 %s 操作", p.database, strings.ToUpper(operation))
+	}
+	return nil
+}
+
+// 检查能否访问这些表
+func (p *accessPolicy) checkTables(tables ...string) error {
+	if !p.restrictsTables() {
+		return nil
+	}
+	for _, table := range tables {
+		if !p.tableAllowed(table) {
+			return fmt.Errorf("拒绝执行: 连接 %s 不允许访问表 %s", p.database, table)
+		}
+	}
+	return nil
+}
+
+func (p *accessPolicy) tableAllowed(table string) bool {
+	if !p.restrictsTables() {
+		return true
+	}
+	if containsFold(p.denied, table) {
+		return false
+	}
+	return len(p.allowed) == 0 || containsFold(p.allowed, table)
+}
+
+// 只保留可以访问的表
+func (p *accessPolicy) filterTables(tables []string) []string {
+	if !p.restrictsTables() {
+		return tables
+	}
+	filtered := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if p.tableAllowed(table) {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered
+}
+
+// 检查原始SQL引用的表；表访问受限时不允许用库名限定表，以免绕过限制
+func (p *accessPolicy) checkRawQuery(query, dialect string) error {
+	if !p.restrictsTables() {
+		return nil
+	}
+	tables, err := referencedTables(query, dialect)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if strings.Contains(table, ".") {
+			return fmt.Errorf("拒绝执行: 连接 %s 限制了可访问的表，原始SQL中不能使用库名限定的表 %s", p.database, table)
+		}
+	}
+	return p.checkTables(tables...)
+}
+
+// 检查结构化查询的操作、主表和JOIN的表
+func (p *accessPolicy) checkStructured(operation, table, joinTables string) error {
+	if err := p.checkOperation(operation); err != nil {
+		return err
+	}
+	tables := []string{table}
+	if joinTables != "" && p.restrictsTables() {
+		names, err := joinTableNames(joinTables)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, names...)
+	}
+	return p.checkTables(tables...)
+}
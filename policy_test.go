@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	readOnly := newAccessPolicy("reports", DatabaseConfig{ReadOnly: true})
+	allowList := newAccessPolicy("reports", DatabaseConfig{AllowedTables: []string{"users", "orders"}, DeniedTables: []string{"Orders"}})
+	denyList := newAccessPolicy("reports", DatabaseConfig{DeniedTables: []string{"secrets"}})
+	var unrestricted *accessPolicy
+
+	tests := []struct {
+		name    string
+		check   func() error
+		wantErr string
+	}{
+		{"nil policy allows writes", func() error { return unrestricted.checkStructured("delete", "secrets", "") }, ""},
+		{"read-only select", func() error { return readOnly.checkOperation("select") }, ""},
+		{"read-only count", func() error { return readOnly.checkOperation("COUNT") }, ""},
+		{"read-only insert", func() error { return readOnly.checkOperation("insert") }, "为只读"},
+		{"read-only update", func() error { return readOnly.checkOperation("UPDATE") }, "为只读"},
+		{"read-only delete", func() error { return readOnly.checkStructured("delete", "users", "") }, "为只读"},
+		{"allowed table", func() error { return allowList.checkTables("users") }, ""},
+		{"allowed table is case-insensitive", func() error { return allowList.checkTables("USERS") }, ""},
+		{"table outside allow list", func() error { return allowList.checkTables("payments") }, "不允许访问表 payments"},
+		{"deny list wins", func() error { return allowList.checkTables("orders") }, "不允许访问表 orders"},
+		{"denied table", func() error { return denyList.checkTables("SECRETS") }, "不允许访问表 SECRETS"},
+		{"other table with deny list", func() error { return denyList.checkTables("users") }, ""},
+		{"denied join", func() error {
+			return denyList.checkStructured("select", "users", `[{"table":"secrets","on":"users.id=secrets.user_id"}]`)
+		}, "不允许访问表 secrets"},
+		{"raw select", func() error { return denyList.checkRawQuery("SELECT * FROM users", "sqlite") }, ""},
+		{"raw denied table", func() error { return denyList.checkRawQuery("SELECT * FROM secrets", "sqlite") }, "不允许访问表 secrets"},
+		{"raw denied table in subquery", func() error {
+			return denyList.checkRawQuery("SELECT * FROM users WHERE id IN (SELECT user_id FROM secrets)", "mysql")
+		}, "不允许访问表 secrets"},
+		{"raw denied table in join", func() error {
+			return denyList.checkRawQuery("SELECT * FROM users u JOIN secrets s ON s.user_id = u.id", "postgres")
+		}, "不允许访问表 secrets"},
+		{"raw denied table inside a cte of the same name", func() error {
+			return denyList.checkRawQuery("WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", "postgres")
+		}, "不允许访问表 secrets"},
+		{"raw denied table next to a subquery cte", func() error {
+			return denyList.checkRawQuery("SELECT * FROM (WITH secrets AS (SELECT 1 AS x) SELECT * FROM secrets) a, secrets", "mysql")
+		}, "不允许访问表 secrets"},
+		{"raw cte of the same name outside allow list", func() error {
+			return allowList.checkRawQuery("WITH payments AS (SELECT * FROM payments) SELECT * FROM payments", "mysql")
+		}, "不允许访问表 payments"},
+		{"raw schema-qualified table", func() error { return denyList.checkRawQuery("SELECT * FROM public.secrets", "postgres") }, "库名限定"},
+		{"raw table outside allow list", func() error { return allowList.checkRawQuery("SELECT * FROM payments", "mysql") }, "不允许访问表 payments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("意外的错误: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("错误 %v 应包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	tables := denyList.filterTables([]string{"users", "Secrets", "orders"})
+	if strings.Join(tables, ",") != "users,orders" {
+		t.Fatalf("filterTables = %v，期望 [users orders]", tables)
+	}
+}
+
+func TestAccessPolicyOnConnection(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{ReadOnly: true, DeniedTables: []string{"orders"}})
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		wantErr   string
+	}{
+		{"select", map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "users"}, ""},
+		{"raw select", map[string]interface{}{"query_type": "raw", "query": "SELECT COUNT(*) AS total FROM users"}, ""},
+		{"structured update", map[string]interface{}{"query_type": "structured", "query": "update", "table_name": "users", "fields": `{"status":"x"}`, "where_conditions": "id=1"}, "为只读"},
+		{"denied table", map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "orders"}, "不允许访问表 orders"},
+		{"raw denied table", map[string]interface{}{"query_type": "raw", "query": "SELECT * FROM users JOIN orders ON orders.user_id = users.id"}, "不允许访问表 orders"},
+		{"qualified table", map[string]interface{}{"query_type": "raw", "query": "SELECT * FROM main.orders"}, "库名限定"},
+		{"model delete", map[string]interface{}{"query_type": "model", "model_name": "users", "query": "delete", "where_conditions": "id=1"}, "为只读"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", tt.arguments))
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.wantErr == "" && result.IsError:
+				t.Fatalf("意外的错误: %s", resultText(result))
+			case tt.wantErr != "" && (!result.IsError || !strings.Contains(resultText(result), tt.wantErr)):
+				t.Fatalf("结果 %q 应为包含 %q 的错误", resultText(result), tt.wantErr)
+			}
+		})
+	}
+	if count := countTestRows(t, "users", "deleted_at IS NULL"); count != 3 {
+		t.Fatalf("只读连接上的用户数 = %d，期望 3", count)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+)
+
+// 预览时返回的受影响记录样例数
+const dryRunSampleRows = 5
+
+// 预览结束后回滚事务用的哨兵错误
+var errDryRunRollback = errors.New("dry run")
+
+// WritePreview dry_run 的预览内容：将执行的SQL、匹配的记录数和受影响记录的样例
+type WritePreview struct {
+	SQL         string                   `json:"sql" jsonschema:"description=将要执行的SQL"`
+	MatchedRows int64                    `json:"matched_rows" jsonschema:"description=WHERE条件匹配的记录数"`
+	Columns     []ResultColumn           `json:"columns" jsonschema:"description=样例记录的列"`
+	Before      []map[string]interface{} `json:"before" jsonschema:"description=受影响记录修改前的样例，按主键排序"`
+	After       []map[string]interface{} `json:"after,omitempty" jsonschema:"description=UPDATE后同一批记录的样子，表没有主键时为空"`
+}
+
+// 预览结构化的UPDATE/DELETE：在事务中实际执行一次以得到影响的记录数和修改后的记录，然后回滚
+func previewStructuredWrite(db *gorm.DB, request mcp.CallToolRequest) (*QueryResult, error) {
+	if request.GetString("table_name", "") == "" {
+		return nil, fmt.Errorf("结构化查询必须指定table_name参数")
+	}
+
+	var result *QueryResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var write *structuredWrite
+		var err error
+		switch strings.ToLower(request.GetString("query", "")) {
+		case "update":
+			write, err = parseStructuredUpdate(tx, request)
+		case "delete":
+			write, err = parseStructuredDelete(tx, request)
+		default:
+			return fmt.Errorf("dry_run 只支持结构化的 update 和 delete")
+		}
+		if err != nil {
+			return err
+		}
+
+		preview := &WritePreview{}
+		preview.SQL = tx.ToSQL(func(dryRun *gorm.DB) *gorm.DB {
+			query, _ := write.exec(dryRun)
+			if query == nil {
+				return dryRun
+			}
+			return query
+		})
+
+		filtered, err := write.filtered(tx)
+		if err != nil {
+			return err
+		}
+		if err := filtered.Count(&preview.MatchedRows).Error; err != nil {
+			return err
+		}
+
+		sample, err := write.filtered(tx)
+		if err != nil {
+			return err
+		}
+		for _, column := range write.scope.primaryKey() {
+			sample = sample.Order(write.scope.quote(column))
+		}
+		preview.Columns, preview.Before, _, err = findPage(sample.Limit(dryRunSampleRows), 0, pageRequest{})
+		if err != nil {
+			return err
+		}
+
+		executed, err := write.exec(tx)
+		if err != nil {
+			return err
+		}
+		if write.operation == "update" {
+			if preview.After, err = write.reload(tx, preview.Before); err != nil {
+				return err
+			}
+		}
+
+		tableName := write.scope.table()
+		result = newWriteResult(write.operation, tableName, executed.RowsAffected,
+			fmt.Sprintf("预览: 将%s表 %s 中的 %d 条记录(未提交)", writeVerb(write.operation), tableName, executed.RowsAffected))
+		result.DryRun = true
+		result.Preview = preview
+		return errDryRunRollback
+	})
+
+	if err != nil && !errors.Is(err, errDryRunRollback) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 按主键重新读取 before 中的记录；主键本身被更新时按新值查找。表没有主键时返回nil
+func (w *structuredWrite) reload(db *gorm.DB, before []map[string]interface{}) ([]map[string]interface{}, error) {
+	primaryKey := w.scope.primaryKey()
+	if len(primaryKey) == 0 {
+		return nil, nil
+	}
+
+	after := make([]map[string]interface{}, 0, len(before))
+	for _, row := range before {
+		query := db.Table(w.scope.table())
+		for _, column := range primaryKey {
+			value := row[column]
+			for key, newValue := range w.data {
+				if strings.EqualFold(key, column) {
+					value = newValue
+				}
+			}
+			query = query.Where(w.scope.quote(column)+" = ?", value)
+		}
+		_, records, _, err := findPage(query.Limit(1), 0, pageRequest{})
+		if err != nil {
+			return nil, err
+		}
+		after = append(after, records...)
+	}
+	return after, nil
+}
+
+// 文本内容：摘要、SQL以及修改前后的样例记录
+func (p *WritePreview) text(summary string) string {
+	var text strings.Builder
+	text.WriteString(summary)
+	text.WriteString(fmt.Sprintf("\nSQL: %s\nWHERE条件匹配 %d 条记录", p.SQL, p.MatchedRows))
+	for _, sample := range []struct {
+		label string
+		rows  []map[string]interface{}
+	}{{"修改前", p.Before}, {"修改后", p.After}} {
+		if len(sample.rows) == 0 {
+			continue
+		}
+		jsonData, err := json.MarshalIndent(sample.rows, "", "  ")
+		if err != nil {
+			continue
+		}
+		text.WriteString(fmt.Sprintf("\n%s(前 %d 条):\n%s", sample.label, len(sample.rows), jsonData))
+	}
+	return text.String()
+}
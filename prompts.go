@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+)
+
+// 提示模板中最多嵌入的表结构数量，避免占满上下文
+const maxPromptTables = 20
+
+// 探索表时附带的示例行数
+const promptSampleRows = 5
+
+// 注册提示模板
+func registerPrompts(s *server.MCPServer) {
+	connectionArg := mcp.WithArgument("connection",
+		mcp.ArgumentDescription("数据库连接名称，默认为 default"),
+	)
+
+	s.AddPrompt(mcp.NewPrompt("explore_table",
+		mcp.WithPromptDescription("探索一张表：结合实时表结构和示例数据，说明表的用途、字段含义和常用查询"),
+		connectionArg,
+		mcp.WithArgument("table",
+			mcp.ArgumentDescription("表名"),
+			mcp.RequiredArgument(),
+		),
+	), handleExploreTablePrompt)
+
+	s.AddPrompt(mcp.NewPrompt("write_report_query",
+		mcp.WithPromptDescription("根据业务问题编写报表查询，附带相关表的实时结构"),
+		connectionArg,
+		mcp.WithArgument("question",
+			mcp.ArgumentDescription("要回答的业务问题，如：上个月每天新增多少活跃用户"),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("tables",
+			mcp.ArgumentDescription("相关的表，逗号分隔；不填时附带所有表的结构"),
+		),
+	), handleWriteReportQueryPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("explain_query_plan",
+		mcp.WithPromptDescription("分析一条SQL的执行计划并给出优化建议，附带所涉及表的列和索引"),
+		connectionArg,
+		mcp.WithArgument("query",
+			mcp.ArgumentDescription("要分析的SQL语句"),
+			mcp.RequiredArgument(),
+		),
+	), handleExplainQueryPlanPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("summarize_search_results",
+		mcp.WithPromptDescription("搜索网络并总结结果，注明来源"),
+		mcp.WithArgument("query",
+			mcp.ArgumentDescription("搜索关键词"),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("focus",
+			mcp.ArgumentDescription("总结时关注的方面，如：价格、发布时间"),
+		),
+		mcp.WithArgument("limit",
+			mcp.ArgumentDescription("搜索结果数量，默认5"),
+		),
+	), handleSummarizeSearchResultsPrompt)
+}
+
+func handleExploreTablePrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	connection := promptArgument(request, "connection", "default")
+	table := promptArgument(request, "table", "")
+	if table == "" {
+		return nil, fmt.Errorf("缺少参数 table")
+	}
+
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := describeTable(ctx, db, connection, table)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []mcp.PromptMessage{
+		schemaMessage(schema),
+	}
+
+	// 有查询权限时附带几行示例数据，不包括已软删除的记录
+	if authorizeQuery(ctx, connection, "select") == nil {
+		if rows, err := sampleRows(ctx, db, connection, table); err == nil && len(rows) > 0 {
+			messages = append(messages, jsonResourceMessage(tableResourceURI(connection, table)+"?sample", rows))
+		}
+	}
+
+	messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(fmt.Sprintf(
+		`请帮我了解数据库连接 %s 中的表 %s。上面附带了它的实时表结构%s。
+请说明：
+1. 这张表可能的业务用途；
+2. 每个字段的含义、取值特点，以及主键、索引和外键反映的关联关系；
+3. 3~5 个有代表性的查询，并使用 database_query 工具(database=%s)实际执行其中一两个来验证你的判断。`,
+		connection, table, sampleNote(len(messages) > 1), connection))))
+
+	return mcp.NewGetPromptResult(fmt.Sprintf("探索表 %s", table), messages), nil
+}
+
+// 读取表的前几行作为示例数据，受连接的查询超时限制
+func sampleRows(ctx context.Context, db *gorm.DB, connection, table string) ([]map[string]interface{}, error) {
+	config, err := dbManager.ConnectionConfig(connection)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	err = runQuery(ctx, db, queryTimeout(config, 0), func(tx *gorm.DB) error {
+		scope, err := newQueryScope(tx, table)
+		if err != nil {
+			return err
+		}
+		return scope.excludeDeleted(tx.Table(scope.table())).Limit(promptSampleRows).Find(&rows).Error
+	})
+	return rows, err
+}
+
+func handleWriteReportQueryPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	connection := promptArgument(request, "connection", "default")
+	question := promptArgument(request, "question", "")
+	if question == "" {
+		return nil, fmt.Errorf("缺少参数 question")
+	}
+
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := splitList(promptArgument(request, "tables", ""))
+	if len(tables) == 0 {
+		if tables, err = listTables(ctx, db, connection); err != nil {
+			return nil, err
+		}
+	}
+
+	messages, omitted, err := schemaMessages(ctx, db, connection, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	instruction := fmt.Sprintf(`请根据上面附带的数据库连接 %s 的实时表结构，编写查询来回答这个问题：
+
+%s
+
+要求：
+1. 只使用表结构中存在的表和字段，不要猜测；
+2. 优先使用 database_query 工具的 structured 模式，需要时再使用 raw 模式的单条只读 SQL (%s 方言)；
+3. 先执行查询检查结果是否合理，再给出最终的查询和对结果的解读；
+4. 如果问题含糊或表结构不足以回答，请说明缺少什么。`, connection, question, dialectDisplayName(db))
+	if omitted > 0 {
+		instruction += fmt.Sprintf("\n\n另有 %d 张表未附带结构，需要时可以调用 describe_table 工具查看。", omitted)
+	}
+	messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instruction)))
+
+	return mcp.NewGetPromptResult("编写报表查询", messages), nil
+}
+
+func handleExplainQueryPlanPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	connection := promptArgument(request, "connection", "default")
+	query := promptArgument(request, "query", "")
+	if query == "" {
+		return nil, fmt.Errorf("缺少参数 query")
+	}
+
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := referencedTables(query, db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	messages, omitted, err := schemaMessages(ctx, db, connection, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	instruction := fmt.Sprintf(`请分析下面这条 SQL 在数据库连接 %s (%s) 上的执行计划：
+
+%s
+
+上面附带了它涉及的表的列和索引。请：
+1. 使用 explain_query 工具获取这条语句实际的执行计划(它同时给出基于已有索引的初步建议)；
+2. 逐步解释执行计划：每张表的访问方式、使用的索引、估算行数，以及是否有全表扫描、临时表或文件排序；
+3. 结合已有索引给出具体的优化建议，例如需要新增的索引(写出 CREATE INDEX 语句)或等价的改写方式。`,
+		connection, dialectDisplayName(db), query)
+	if omitted > 0 {
+		instruction += fmt.Sprintf("\n\n另有 %d 张表未附带结构，需要时可以调用 describe_table 工具查看。", omitted)
+	}
+	messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instruction)))
+
+	return mcp.NewGetPromptResult("分析执行计划", messages), nil
+}
+
+func handleSummarizeSearchResultsPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	query := promptArgument(request, "query", "")
+	if query == "" {
+		return nil, fmt.Errorf("缺少参数 query")
+	}
+	focus := promptArgument(request, "focus", "")
+	limit, err := strconv.Atoi(promptArgument(request, "limit", "5"))
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("参数 limit 必须是正整数")
+	}
+
+	instruction := fmt.Sprintf("请总结关于「%s」的网络搜索结果", query)
+	if focus != "" {
+		instruction += fmt.Sprintf("，重点关注：%s", focus)
+	}
+	instruction += "。归纳要点，指出不同来源之间的分歧，并在每个要点后用 [序号] 注明来源。"
+
+	var messages []mcp.PromptMessage
+
+	// 当前客户端可以使用 web_search 时直接附带搜索结果，否则让模型自行调用工具
+	searchErr := authorizeTool(ctx, "web_search")
+	if searchErr == nil && !appConfig.Tools.IsEnabled("web_search") {
+		searchErr = fmt.Errorf("web_search 工具已被配置禁用")
+	}
+	if searchErr == nil {
+		var results []SearchResult
+		if results, searchErr = performWebSearch(ctx, query, limit); searchErr == nil {
+			messages = append(messages, jsonResourceMessage("search://"+query, results))
+			instruction = "上面附带了搜索结果。" + instruction
+		}
+	}
+	if searchErr != nil {
+		instruction = fmt.Sprintf("请先使用 web_search 工具搜索「%s」(limit=%d)。", query, limit) + instruction
+	}
+
+	messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instruction)))
+	return mcp.NewGetPromptResult("总结搜索结果", messages), nil
+}
+
+// 读取提示参数，未提供时返回默认值
+func promptArgument(request mcp.GetPromptRequest, name, defaultValue string) string {
+	if value := strings.TrimSpace(request.Params.Arguments[name]); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// 读取多张表的结构作为嵌入资源，超出数量上限的表只计数
+func schemaMessages(ctx context.Context, db *gorm.DB, connection string, tables []string) ([]mcp.PromptMessage, int, error) {
+	omitted := 0
+	if len(tables) > maxPromptTables {
+		omitted = len(tables) - maxPromptTables
+		tables = tables[:maxPromptTables]
+	}
+
+	messages := make([]mcp.PromptMessage, 0, len(tables)+1)
+	for _, table := range tables {
+		schema, err := describeTable(ctx, db, connection, table)
+		if err != nil {
+			return nil, 0, err
+		}
+		messages = append(messages, schemaMessage(schema))
+	}
+	return messages, omitted, nil
+}
+
+func schemaMessage(schema *TableSchema) mcp.PromptMessage {
+	return jsonResourceMessage(tableResourceURI(schema.Connection, schema.Table), schema)
+}
+
+// 把数据以JSON嵌入资源的形式放进提示消息
+func jsonResourceMessage(uri string, v interface{}) mcp.PromptMessage {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(err.Error()))
+	}
+	return mcp.NewPromptMessage(mcp.RoleUser, mcp.NewEmbeddedResource(mcp.TextResourceContents{
+		URI:      uri,
+		MIMEType: "application/json",
+		Text:     string(jsonData),
+	}))
+}
+
+func tableResourceURI(connection, table string) string {
+	return fmt.Sprintf("db://%s/tables/%s", connection, table)
+}
+
+func sampleNote(hasSample bool) string {
+	if hasSample {
+		return fmt.Sprintf("和前 %d 行示例数据", promptSampleRows)
+	}
+	return ""
+}
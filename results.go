@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// QueryResult database_query 的结构化结果，同时作为工具的输出模式
+type QueryResult struct {
+	Database     string                   `json:"database" jsonschema:"description=数据库连接名称"`
+	Table        string                   `json:"table,omitempty" jsonschema:"description=结构化查询的表名"`
+	Operation    string                   `json:"operation" jsonschema:"description=执行的操作，如 select、count、insert、raw"`
+	Columns      []ResultColumn           `json:"columns" jsonschema:"description=结果列，按查询返回的顺序"`
+	Rows         []map[string]interface{} `json:"rows" jsonschema:"description=结果记录，键为列名"`
+	RowCount     int                      `json:"row_count" jsonschema:"description=返回的记录数"`
+	RowsAffected *int64                   `json:"rows_affected,omitempty" jsonschema:"description=写操作影响的记录数"`
+	Truncated    bool                     `json:"truncated" jsonschema:"description=结果是否因数量限制被截断"`
+	NextCursor   string                   `json:"next_cursor,omitempty" jsonschema:"description=结果被截断时获取下一页的cursor"`
+	DryRun       bool                     `json:"dry_run,omitempty" jsonschema:"description=是否为未提交的预览"`
+	Preview      *WritePreview            `json:"preview,omitempty" jsonschema:"description=dry_run 时的预览内容"`
+	Insert       *InsertStats             `json:"insert,omitempty" jsonschema:"description=insert 操作的插入、更新和跳过的记录数以及主键"`
+
+	summary  string // 文本内容中的摘要
+	omitRows bool   // 摘要已包含全部信息，文本内容中不再附带记录
+}
+
+// ResultColumn 结果列及其数据库类型，驱动无法提供类型时为空
+type ResultColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SearchResponse web_search 的结构化结果
+type SearchResponse struct {
+	Query   string         `json:"query" jsonschema:"description=搜索关键词"`
+	Results []SearchResult `json:"results" jsonschema:"description=搜索结果"`
+	Count   int            `json:"count" jsonschema:"description=结果数量"`
+}
+
+// pageRequest 本次调用要返回的一页记录
+type pageRequest struct {
+	position int // 之前各页已返回的记录数
+	size     int // 本页最多返回的记录数，0表示不限
+	maxBytes int // 本页记录按JSON序列化后的最大字节数，0表示不限
+}
+
+// 按配置的上限确定页大小，pageSize 为调用方指定的值，超过上限时取上限
+func newPageRequest(position, pageSize int) pageRequest {
+	size := appConfig.Query.MaxRows
+	if pageSize > 0 && (size == 0 || pageSize < size) {
+		size = pageSize
+	}
+	return pageRequest{position: position, size: size, maxBytes: appConfig.Query.MaxBytes}
+}
+
+// 给查询加上本页的 OFFSET/LIMIT；offset 和 limit 是调用方指定的整体范围，limit 为0表示不限。
+// 多取一条用于判断是否还有下一页
+func (p pageRequest) apply(query *gorm.DB, offset, limit int) *gorm.DB {
+	if offset+p.position > 0 {
+		query = query.Offset(offset + p.position)
+	}
+	fetch := -1
+	if p.size > 0 {
+		fetch = p.size + 1
+	}
+	if limit > 0 {
+		remaining := max(limit-p.position, 0)
+		if fetch < 0 || remaining < fetch {
+			fetch = remaining
+		}
+	}
+	if fetch >= 0 {
+		query = query.Limit(fetch)
+	}
+	return query
+}
+
+// 执行查询并读取一页记录及列类型；skip 为先跳过的记录数，用于无法改写 LIMIT 的原始SQL
+func findPage(query *gorm.DB, skip int, page pageRequest) ([]ResultColumn, []map[string]interface{}, bool, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rows.Close()
+	return scanPage(query, rows, skip, page)
+}
+
+// 逐行读取，达到行数或字节数上限时停止；返回值 more 表示后面还有记录
+func scanPage(db *gorm.DB, rows *sql.Rows, skip int, page pageRequest) ([]ResultColumn, []map[string]interface{}, bool, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	columns := make([]ResultColumn, len(columnTypes))
+	for i, columnType := range columnTypes {
+		columns[i] = ResultColumn{Name: columnType.Name(), Type: strings.ToLower(columnType.DatabaseTypeName())}
+	}
+
+	records := []map[string]interface{}{}
+	size := 0
+	for rows.Next() {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if page.size > 0 && len(records) == page.size {
+			return columns, records, true, nil
+		}
+
+		record := map[string]interface{}{}
+		if err := db.ScanRows(rows, &record); err != nil {
+			return nil, nil, false, err
+		}
+		if page.maxBytes > 0 {
+			encoded, err := json.Marshal(record)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			size += len(encoded)
+			if size > page.maxBytes {
+				if len(records) == 0 {
+					return nil, nil, false, fmt.Errorf("单条记录超过 %d 字节的结果上限，请减少查询的字段", page.maxBytes)
+				}
+				return columns, records, true, nil
+			}
+		}
+		records = append(records, record)
+	}
+	return columns, records, false, rows.Err()
+}
+
+// queryCursor 翻页所需的状态：首次调用的参数、已返回的记录数和已确认的查询代价
+type queryCursor struct {
+	Arguments map[string]interface{} `json:"a"`
+	Position  int                    `json:"p"`
+	Cost      *int64                 `json:"c,omitempty"` // 首页已确认的估计行数，之后的页不再需要 confirm_token
+}
+
+// 确认令牌有有效期，不放入游标，已确认的代价由 cost 带到之后的页
+func encodeCursor(arguments map[string]interface{}, position int, cost *int64) (string, error) {
+	state := queryCursor{Arguments: make(map[string]interface{}, len(arguments)), Position: position, Cost: cost}
+	for key, value := range arguments {
+		if key != "cursor" && key != "confirm_token" {
+			state.Arguments[key] = value
+		}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cursorSignature(payload)), nil
+}
+
+func decodeCursor(cursor string) (*queryCursor, error) {
+	payload, encodedSignature, ok := strings.Cut(cursor, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("无效的cursor")
+	}
+	if !hmac.Equal(signature, cursorSignature(payload)) {
+		return nil, fmt.Errorf("无效的cursor：游标已被修改或服务器已重启，请重新查询")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("无效的cursor")
+	}
+	var state queryCursor
+	if err := json.Unmarshal(data, &state); err != nil || state.Arguments == nil || state.Position < 0 {
+		return nil, fmt.Errorf("无效的cursor")
+	}
+	return &state, nil
+}
+
+// 对游标内容签名，防止客户端修改其中的参数和位置；与确认令牌使用同一密钥，服务器重启后游标失效
+func cursorSignature(payload string) []byte {
+	mac := hmac.New(sha256.New, confirmSecret)
+	mac.Write([]byte("cursor"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// 读操作结果，summary 为文本内容中的摘要，truncated 表示还有下一页
+func newRowsResult(operation, table string, columns []ResultColumn, rows []map[string]interface{}, truncated bool, summary string) *QueryResult {
+	return &QueryResult{
+		Table:     table,
+		Operation: operation,
+		Columns:   columns,
+		Rows:      rows,
+		RowCount:  len(rows),
+		Truncated: truncated,
+		summary:   summary,
+	}
+}
+
+// 写操作结果
+func newWriteResult(operation, table string, rowsAffected int64, summary string) *QueryResult {
+	return &QueryResult{
+		Table:        table,
+		Operation:    operation,
+		Columns:      []ResultColumn{},
+		Rows:         []map[string]interface{}{},
+		RowsAffected: &rowsAffected,
+		summary:      summary,
+	}
+}
+
+// 文本内容：摘要加上JSON格式的记录，供不支持结构化内容的客户端阅读
+func (r *QueryResult) text() string {
+	if r.Preview != nil {
+		return r.Preview.text(r.summary)
+	}
+	if r.Insert != nil {
+		return r.Insert.text(r.summary)
+	}
+	if len(r.Rows) == 0 || r.omitRows {
+		return r.summary
+	}
+	jsonData, err := json.MarshalIndent(r.Rows, "", "  ")
+	if err != nil {
+		return r.summary
+	}
+	text := fmt.Sprintf("%s\n%s", r.summary, jsonData)
+	if r.NextCursor != "" {
+		text += fmt.Sprintf("\n结果已截断，传入 cursor=%s 获取下一页", r.NextCursor)
+	}
+	return text
+}
+
+// 文本内容：编号列出的搜索结果
+func (r *SearchResponse) text() string {
+	var resultText strings.Builder
+	resultText.WriteString(fmt.Sprintf("网络搜索结果 - 关键词: '%s'\n", r.Query))
+	resultText.WriteString(fmt.Sprintf("找到 %d 条结果:\n\n", r.Count))
+
+	for i, result := range r.Results {
+		resultText.WriteString(fmt.Sprintf("%d. %s\n", i+1, result.Title))
+		resultText.WriteString(fmt.Sprintf("   URL: %s\n", result.URL))
+		if result.Snippet != "" {
+			// 限制摘要长度
+			snippet := result.Snippet
+			if len(snippet) > 200 {
+				snippet = snippet[:200] + "..."
+			}
+			resultText.WriteString(fmt.Sprintf("   摘要: %s\n", snippet))
+		}
+		resultText.WriteString("\n")
+	}
+
+	if len(r.Results) == 0 {
+		resultText.WriteString("未找到相关搜索结果")
+	}
+	return resultText.String()
+}
+
+// COUNT结果，以单行 count 列的形式返回
+func countResult(table string, count int64, summary string) *QueryResult {
+	return &QueryResult{
+		Table:     table,
+		Operation: "count",
+		Columns:   []ResultColumn{{Name: "count", Type: "bigint"}},
+		Rows:      []map[string]interface{}{{"count": count}},
+		RowCount:  1,
+		summary:   summary,
+		omitRows:  true,
+	}
+}
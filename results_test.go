@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cost := int64(5000)
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		position  int
+		cost      *int64
+		want      map[string]interface{}
+	}{
+		{
+			name:      "structured select",
+			arguments: map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "users", "page_size": float64(2)},
+			position:  2,
+			want:      map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "users", "page_size": float64(2)},
+		},
+		{
+			name:      "confirm_token and cursor are dropped",
+			arguments: map[string]interface{}{"query": "SELECT * FROM users", "confirm_token": "abc.def", "cursor": "old"},
+			position:  100,
+			cost:      &cost,
+			want:      map[string]interface{}{"query": "SELECT * FROM users"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := encodeCursor(tt.arguments, tt.position, tt.cost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, err := decodeCursor(cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(state.Arguments, tt.want) || state.Position != tt.position || !reflect.DeepEqual(state.Cost, tt.cost) {
+				t.Fatalf("游标内容 = %+v，期望参数 %v、位置 %d、代价 %v", state, tt.want, tt.position, tt.cost)
+			}
+		})
+	}
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	cursor, err := encodeCursor(map[string]interface{}{"query": "select", "table_name": "users"}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(cursor, ".")
+	edited := base64.RawURLEncoding.EncodeToString([]byte(`{"a":{"query":"select","table_name":"secrets"},"p":0}`))
+
+	tests := []struct {
+		name    string
+		cursor  string
+		wantErr string
+	}{
+		{"edited payload", edited + "." + signature, "已被修改"},
+		{"edited signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("forged")), "已被修改"},
+		{"unsigned", payload, "无效的cursor"},
+		{"garbage", "%%%", "无效的cursor"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeCursor(tt.cursor); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: decodeCursor 的错误 = %v，应包含 %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryPaging(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{})
+	arguments := map[string]interface{}{
+		"query_type": "structured",
+		"query":      "select",
+		"table_name": "users",
+		"fields":     "id",
+		"order_by":   "id",
+		"page_size":  2,
+	}
+
+	var ids []interface{}
+	for page := 0; page < 3; page++ {
+		result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", arguments))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.IsError {
+			t.Fatalf("第 %d 页: %s", page+1, resultText(result))
+		}
+		content := result.StructuredContent.(*QueryResult)
+		for _, row := range content.Rows {
+			ids = append(ids, row["id"])
+		}
+		if content.NextCursor == "" {
+			break
+		}
+		// 翻页时只传 cursor，其他参数来自游标
+		arguments = map[string]interface{}{"query_type": "structured", "query": "select", "cursor": content.NextCursor}
+	}
+	if !reflect.DeepEqual(ids, []interface{}{int64(1), int64(2), int64(3)}) {
+		t.Fatalf("分页返回的 id = %v，期望 [1 2 3]", ids)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+)
+
+// 表结构资源URI模板
+const (
+	tablesResourceTemplate      = "db://{connection}/tables"
+	tableSchemaResourceTemplate = "db://{connection}/tables/{table}"
+)
+
+// TableSchema 表结构：列、索引和外键
+type TableSchema struct {
+	Connection  string           `json:"connection"`
+	Table       string           `json:"table"`
+	Columns     []ColumnInfo     `json:"columns"`
+	Indexes     []IndexInfo      `json:"indexes"`
+	ForeignKeys []ForeignKeyInfo `json:"foreign_keys"`
+}
+
+// ColumnInfo 列信息，驱动无法提供的属性会被省略
+type ColumnInfo struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Nullable      *bool   `json:"nullable,omitempty"`
+	Default       *string `json:"default,omitempty"`
+	PrimaryKey    bool    `json:"primary_key,omitempty"`
+	AutoIncrement bool    `json:"auto_increment,omitempty"`
+	Unique        bool    `json:"unique,omitempty"`
+	Comment       string  `json:"comment,omitempty"`
+}
+
+// IndexInfo 索引信息
+type IndexInfo struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	Unique     bool     `json:"unique"`
+	PrimaryKey bool     `json:"primary_key,omitempty"`
+}
+
+// ForeignKeyInfo 外键信息，多列外键每列一条
+type ForeignKeyInfo struct {
+	Name             string `json:"name" gorm:"column:name"`
+	Column           string `json:"column" gorm:"column:column_name"`
+	ReferencedTable  string `json:"referenced_table" gorm:"column:referenced_table"`
+	ReferencedColumn string `json:"referenced_column" gorm:"column:referenced_column"`
+}
+
+// 列出服务器上的数据库
+func listDatabases(ctx context.Context, db *gorm.DB) ([]string, error) {
+	driver, err := LookupDriver(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if driver.ListDatabasesQuery == "" {
+		return nil, fmt.Errorf("%s 驱动不支持列出数据库", driver.DisplayName)
+	}
+
+	var names []string
+	if err := db.WithContext(ctx).Raw(driver.ListDatabasesQuery).Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("列出数据库失败: %v", err)
+	}
+	return names, nil
+}
+
+// 列出当前数据库中连接允许访问的表
+func listTables(ctx context.Context, db *gorm.DB, connection string) ([]string, error) {
+	tables, err := db.WithContext(ctx).Migrator().GetTables()
+	if err != nil {
+		return nil, fmt.Errorf("列出表失败: %v", err)
+	}
+	return connectionPolicy(connection).filterTables(tables), nil
+}
+
+// 读取表的列、索引和外键
+func describeTable(ctx context.Context, db *gorm.DB, connection, table string) (*TableSchema, error) {
+	// 与 queryScope 一样只接受不带库名的表名，否则 PostgreSQL 上的 schema.table 会绕过表访问限制
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("无效的表名 %q", table)
+	}
+	if err := connectionPolicy(connection).checkTables(table); err != nil {
+		return nil, auditDenied(ctx, err)
+	}
+	db = db.WithContext(ctx)
+	migrator := db.Migrator()
+	if !migrator.HasTable(table) {
+		return nil, fmt.Errorf("表 %s 不存在", table)
+	}
+
+	schema := &TableSchema{
+		Connection:  connection,
+		Table:       table,
+		Columns:     []ColumnInfo{},
+		Indexes:     []IndexInfo{},
+		ForeignKeys: []ForeignKeyInfo{},
+	}
+
+	columnTypes, err := migrator.ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("读取表 %s 的列失败: %v", table, err)
+	}
+	for _, columnType := range columnTypes {
+		column := ColumnInfo{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+		if fullType, ok := columnType.ColumnType(); ok && fullType != "" {
+			column.Type = fullType
+		}
+		if nullable, ok := columnType.Nullable(); ok {
+			column.Nullable = &nullable
+		}
+		if value, ok := columnType.DefaultValue(); ok {
+			column.Default = &value
+		}
+		column.PrimaryKey, _ = columnType.PrimaryKey()
+		column.AutoIncrement, _ = columnType.AutoIncrement()
+		column.Unique, _ = columnType.Unique()
+		column.Comment, _ = columnType.Comment()
+		schema.Columns = append(schema.Columns, column)
+	}
+
+	indexes, err := migrator.GetIndexes(table)
+	if err != nil {
+		return nil, fmt.Errorf("读取表 %s 的索引失败: %v", table, err)
+	}
+	for _, index := range indexes {
+		info := IndexInfo{Name: index.Name(), Columns: index.Columns()}
+		info.Unique, _ = index.Unique()
+		info.PrimaryKey, _ = index.PrimaryKey()
+		schema.Indexes = append(schema.Indexes, info)
+	}
+
+	if driver, err := LookupDriver(db.Dialector.Name()); err == nil && driver.ForeignKeysQuery != "" {
+		if err := db.Raw(driver.ForeignKeysQuery, table).Scan(&schema.ForeignKeys).Error; err != nil {
+			return nil, fmt.Errorf("读取表 %s 的外键失败: %v", table, err)
+		}
+	}
+	return schema, nil
+}
+
+// 注册表结构查询工具和资源
+func registerSchemaTools(s *server.MCPServer) {
+	connectionArg := mcp.WithString("connection",
+		mcp.DefaultString("default"),
+		mcp.Description("数据库连接名称"),
+	)
+
+	listDatabasesTool := mcp.NewTool("list_databases",
+		mcp.WithDescription("列出数据库连接所在服务器上的数据库"),
+		connectionArg,
+	)
+	addTool(s, listDatabasesTool, handleListDatabases)
+
+	listTablesTool := mcp.NewTool("list_tables",
+		mcp.WithDescription("列出数据库连接中的表"),
+		connectionArg,
+	)
+	addTool(s, listTablesTool, handleListTables)
+
+	describeTableTool := mcp.NewTool("describe_table",
+		mcp.WithDescription("查看表结构：列(类型、是否可空、默认值、主键)、索引和外键"),
+		connectionArg,
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("表名"),
+		),
+	)
+	addTool(s, describeTableTool, handleDescribeTable)
+
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(tablesResourceTemplate, "tables",
+			mcp.WithTemplateDescription("数据库连接中的表"),
+			mcp.WithTemplateMIMEType("application/json"),
+		),
+		handleTablesResource,
+	)
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(tableSchemaResourceTemplate, "table_schema",
+			mcp.WithTemplateDescription("表结构：列、索引和外键"),
+			mcp.WithTemplateMIMEType("application/json"),
+		),
+		handleTableSchemaResource,
+	)
+}
+
+// 检查权限并获取连接
+func schemaConnection(ctx context.Context, connection string) (*gorm.DB, error) {
+	if err := authorizeConnection(ctx, connection); err != nil {
+		return nil, err
+	}
+	return dbManager.GetConnection(connection)
+}
+
+func handleListDatabases(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	connection := request.GetString("connection", "default")
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return databaseErrorResult(err), nil
+	}
+
+	names, err := listDatabases(ctx, db)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonToolResult(map[string]interface{}{
+		"connection": connection,
+		"driver":     dialectDisplayName(db),
+		"databases":  names,
+	})
+}
+
+func handleListTables(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	connection := request.GetString("connection", "default")
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return databaseErrorResult(err), nil
+	}
+
+	tables, err := listTables(ctx, db, connection)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonToolResult(map[string]interface{}{
+		"connection": connection,
+		"tables":     tables,
+	})
+}
+
+func handleDescribeTable(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	connection := request.GetString("connection", "default")
+	table, err := request.RequireString("table")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return databaseErrorResult(err), nil
+	}
+
+	schema, err := describeTable(ctx, db, connection, table)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonToolResult(schema)
+}
+
+func handleTablesResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	connection := resourceArgument(request, "connection")
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := listTables(ctx, db, connection)
+	if err != nil {
+		return nil, err
+	}
+	return jsonResourceContents(request.Params.URI, map[string]interface{}{
+		"connection": connection,
+		"tables":     tables,
+	})
+}
+
+func handleTableSchemaResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	connection := resourceArgument(request, "connection")
+	db, err := schemaConnection(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := describeTable(ctx, db, connection, resourceArgument(request, "table"))
+	if err != nil {
+		return nil, err
+	}
+	return jsonResourceContents(request.Params.URI, schema)
+}
+
+// 取出URI模板中匹配到的变量
+func resourceArgument(request mcp.ReadResourceRequest, name string) string {
+	switch value := request.Params.Arguments[name].(type) {
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	}
+	return ""
+}
+
+func jsonToolResult(v interface{}) (*mcp.CallToolResult, error) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+func jsonResourceContents(uri string, v interface{}) ([]mcp.ResourceContents, error) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      uri,
+			MIMEType: "application/json",
+			Text:     string(jsonData),
+		},
+	}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gorm.io/gorm"
+)
+
+// 带 gorm.DeletedAt 字段的模型额外支持的操作
+const (
+	modelOperationDelete  = "delete"  // 软删除：只记录删除时间
+	modelOperationRestore = "restore" // 恢复软删除的记录
+	modelOperationPurge   = "purge"   // 永久删除已软删除的记录，需要 confirm_purge
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// 模型是否使用软删除，即含有 gorm.DeletedAt 字段(包括嵌入的 gorm.Model)
+func (m ModelDefinition) softDeletes() bool {
+	return hasDeletedAt(reflect.TypeOf(m.Model))
+}
+
+func hasDeletedAt(t reflect.Type) bool {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type == deletedAtType || (field.Anonymous && hasDeletedAt(field.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 模型的软删除列名，由gorm按命名策略解析
+func (m ModelDefinition) deletedAtColumn(db *gorm.DB) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m.Model); err != nil {
+		return "", fmt.Errorf("解析模型 %s 失败: %v", m.Name, err)
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field.DBName, nil
+		}
+	}
+	return "", nil
+}
+
+// 新的模型实例：gorm 写入时会回填字段，不能使用注册表中共享的实例
+func (m ModelDefinition) newModel() interface{} {
+	return reflect.New(reflect.TypeOf(m.Model).Elem()).Interface()
+}
+
+// 表所属的软删除模型的软删除列，表不属于任何软删除模型时返回空字符串
+func softDeleteColumn(db *gorm.DB, table string) string {
+	for _, name := range ModelNames() {
+		model := modelRegistry[name]
+		if !model.softDeletes() {
+			continue
+		}
+		if modelTable, err := model.table(db); err != nil || !strings.EqualFold(modelTable, table) {
+			continue
+		}
+		if column, err := model.deletedAtColumn(db); err == nil && column != "" {
+			return column
+		}
+	}
+	return ""
+}
+
+// 排除主表中已软删除的记录，主表不属于软删除模型时原样返回
+func (s *queryScope) excludeDeleted(query *gorm.DB) *gorm.DB {
+	if s.softDelete == "" {
+		return query
+	}
+	return query.Where(s.quote(s.table()) + "." + s.quote(s.softDelete) + " IS NULL")
+}
+
+// 软删除模型的 delete/restore/purge 作用的记录：delete 为未删除的记录，restore 和 purge 为已软删除的记录
+func softDeleteTarget(db, query *gorm.DB, model ModelDefinition, operation string, request mcp.CallToolRequest) (*gorm.DB, error) {
+	column, err := model.deletedAtColumn(db)
+	if err != nil {
+		return nil, err
+	}
+	switch operation {
+	case modelOperationDelete:
+		return query, nil
+	case modelOperationPurge:
+		if !request.GetBool("confirm_purge", false) {
+			return nil, fmt.Errorf("purge 会永久删除已软删除的记录且无法恢复，确认后请设置 confirm_purge=true 重新调用")
+		}
+	case modelOperationRestore:
+	default:
+		return nil, fmt.Errorf("模型 %s 的写操作 %s 没有设置 Execute", model.Name, operation)
+	}
+	return query.Unscoped().Where(db.Statement.Quote(column) + " IS NOT NULL"), nil
+}
+
+// 执行软删除模型的 delete/restore/purge，query 已带上 where_conditions
+func executeSoftDeleteOperation(db, query *gorm.DB, model ModelDefinition, table, operation string, request mcp.CallToolRequest) (*QueryResult, error) {
+	column, err := model.deletedAtColumn(db)
+	if err != nil {
+		return nil, err
+	}
+	if query, err = softDeleteTarget(db, query, model, operation, request); err != nil {
+		return nil, err
+	}
+
+	var result *gorm.DB
+	var summary string
+	switch operation {
+	case modelOperationDelete:
+		result = query.Delete(model.newModel())
+		summary = fmt.Sprintf("已软删除模型 %s 的 %d 条记录，可用 restore 操作恢复", model.Name, result.RowsAffected)
+	case modelOperationRestore:
+		result = query.Update(column, nil)
+		summary = fmt.Sprintf("已恢复模型 %s 的 %d 条记录", model.Name, result.RowsAffected)
+	default:
+		result = query.Delete(model.newModel())
+		summary = fmt.Sprintf("已永久删除模型 %s 的 %d 条已软删除的记录", model.Name, result.RowsAffected)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("模型 %s 执行 %s 失败: %v", model.Name, operation, result.Error)
+	}
+	return newWriteResult(operation, table, result.RowsAffected, summary), nil
+}
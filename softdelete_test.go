@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestModelSoftDelete(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{})
+	steps := []struct {
+		name      string
+		arguments map[string]interface{}
+		wantErr   string
+		visible   int64 // 之后未删除的用户数
+		deleted   int64 // 之后已软删除的用户数
+	}{
+		{
+			name:      "delete requires conditions",
+			arguments: map[string]interface{}{"query": "delete"},
+			wantErr:   "必须指定where_conditions",
+			visible:   3,
+		},
+		{
+			name:      "delete",
+			arguments: map[string]interface{}{"query": "delete", "where_conditions": `{"status":"active"}`},
+			visible:   1,
+			deleted:   2,
+		},
+		{
+			name:      "filters are limited to model fields",
+			arguments: map[string]interface{}{"query": "delete", "where_conditions": "deleted_at is null"},
+			wantErr:   "可过滤的字段",
+			visible:   1,
+			deleted:   2,
+		},
+		{
+			name:      "restore",
+			arguments: map[string]interface{}{"query": "restore", "where_conditions": "id=1"},
+			visible:   2,
+			deleted:   1,
+		},
+		{
+			name:      "purge requires confirm_purge",
+			arguments: map[string]interface{}{"query": "purge", "where_conditions": "id>=1"},
+			wantErr:   "confirm_purge",
+			visible:   2,
+			deleted:   1,
+		},
+		{
+			name:      "purge only removes soft-deleted rows",
+			arguments: map[string]interface{}{"query": "purge", "where_conditions": "id>=1", "confirm_purge": true},
+			visible:   2,
+		},
+		{
+			name:      "restore after purge finds nothing",
+			arguments: map[string]interface{}{"query": "restore", "where_conditions": "id>=1"},
+			visible:   2,
+		},
+	}
+	for _, step := range steps {
+		step.arguments["query_type"] = "model"
+		step.arguments["model_name"] = "users"
+		result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", step.arguments))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case step.wantErr == "" && result.IsError:
+			t.Fatalf("%s: 意外的错误 %s", step.name, resultText(result))
+		case step.wantErr != "" && (!result.IsError || !strings.Contains(resultText(result), step.wantErr)):
+			t.Fatalf("%s: 结果 %q 应为包含 %q 的错误", step.name, resultText(result), step.wantErr)
+		}
+		visible := countTestRows(t, "users", "deleted_at IS NULL")
+		deleted := countTestRows(t, "users", "deleted_at IS NOT NULL")
+		if visible != step.visible || deleted != step.deleted {
+			t.Fatalf("%s 之后: 未删除 %d 条、已软删除 %d 条，期望 %d、%d", step.name, visible, deleted, step.visible, step.deleted)
+		}
+	}
+}
+
+func TestSoftDeletedRowsAreHidden(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{})
+	db, err := dbManager.GetConnection("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE id = 2").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		want      int
+	}{
+		{"model list", map[string]interface{}{"query_type": "model", "model_name": "users", "query": "list"}, 2},
+		{"model list including deleted", map[string]interface{}{"query_type": "model", "model_name": "users", "query": "list", "include_deleted": true}, 3},
+		{"structured select", map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "users"}, 2},
+		{"structured select including deleted", map[string]interface{}{"query_type": "structured", "query": "select", "table_name": "users", "include_deleted": true}, 3},
+	}
+	for _, tt := range tests {
+		result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", tt.arguments))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.IsError {
+			t.Fatalf("%s: %s", tt.name, resultText(result))
+		}
+		if rows := len(result.StructuredContent.(*QueryResult).Rows); rows != tt.want {
+			t.Errorf("%s 返回 %d 条记录，期望 %d", tt.name, rows, tt.want)
+		}
+	}
+
+	// 结构化 update 不影响已软删除的记录
+	update := map[string]interface{}{"query_type": "structured", "query": "update", "table_name": "users", "fields": `{"status":"inactive"}`, "where_conditions": "id>=1"}
+	result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", update))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected := result.StructuredContent.(*QueryResult).RowsAffected; affected == nil || *affected != 2 {
+		t.Fatalf("更新影响的记录数 = %v，期望 2", affected)
+	}
+}
+
+func TestModelWriteConfirmation(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{ConfirmThreshold: 1})
+	call := func(arguments map[string]interface{}) string {
+		t.Helper()
+		arguments["query_type"] = "model"
+		arguments["model_name"] = "users"
+		result, err := handleDatabaseQuery(context.Background(), newTestRequest("database_query", arguments))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.IsError {
+			return ""
+		}
+		return resultText(result)
+	}
+	token := func(text string) string {
+		t.Helper()
+		index := strings.LastIndex(text, "confirm_token=")
+		if index < 0 {
+			t.Fatalf("超过阈值的操作应返回确认令牌，实际: %s", text)
+		}
+		return strings.TrimSpace(text[index+len("confirm_token="):])
+	}
+
+	// 删除两条记录超过阈值，没有令牌时不执行
+	remove := map[string]interface{}{"query": "delete", "where_conditions": `{"status":"active"}`}
+	text := call(remove)
+	if count := countTestRows(t, "users", "deleted_at IS NULL"); count != 3 {
+		t.Fatalf("确认前未删除的用户数 = %d，期望 3", count)
+	}
+	remove["confirm_token"] = token(text)
+	if text := call(remove); text != "" {
+		t.Fatalf("带令牌重新调用失败: %s", text)
+	}
+	if count := countTestRows(t, "users", "deleted_at IS NULL"); count != 1 {
+		t.Fatalf("确认后未删除的用户数 = %d，期望 1", count)
+	}
+
+	// 只设置 confirm_purge 不能绕过确认阈值
+	purge := map[string]interface{}{"query": "purge", "where_conditions": "id>=1", "confirm_purge": true}
+	text = call(purge)
+	if count := countTestRows(t, "users", "deleted_at IS NOT NULL"); count != 2 {
+		t.Fatalf("确认前已软删除的用户数 = %d，期望 2", count)
+	}
+	purge["confirm_token"] = token(text)
+	if text := call(purge); text != "" {
+		t.Fatalf("带令牌重新调用失败: %s", text)
+	}
+	if count := countTestRows(t, "users", "1 = 1"); count != 1 {
+		t.Fatalf("永久删除后的用户数 = %d，期望 1", count)
+	}
+
+	// 单条记录的修改不超过阈值
+	if text := call(map[string]interface{}{"query": "deactivate", "where_conditions": `{"id":2}`}); text != "" {
+		t.Fatalf("停用用户失败: %s", text)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver" // 解析器需要的字面量实现
+)
+
+// 各方言中有副作用或会长时间占用连接的函数，原始查询中禁止使用；键为小写函数名，值为原因
+var mysqlSideEffectFunctions = map[string]string{
+	"sleep":                             "会长时间占用连接",
+	"benchmark":                         "会长时间占用连接",
+	"get_lock":                          "会获取命名锁",
+	"release_lock":                      "会释放命名锁",
+	"release_all_locks":                 "会释放命名锁",
+	"load_file":                         "会读取服务器文件",
+	"master_pos_wait":                   "会阻塞等待复制",
+	"source_pos_wait":                   "会阻塞等待复制",
+	"wait_for_executed_gtid_set":        "会阻塞等待复制",
+	"wait_until_sql_thread_after_gtids": "会阻塞等待复制",
+	"nextval":                           "会修改序列",
+	"setval":                            "会修改序列",
+}
+
+var postgresSideEffectFunctions = map[string]string{
+	"pg_sleep":                            "会长时间占用连接",
+	"pg_sleep_for":                        "会长时间占用连接",
+	"pg_sleep_until":                      "会长时间占用连接",
+	"pg_read_file":                        "会读取服务器文件",
+	"pg_read_binary_file":                 "会读取服务器文件",
+	"pg_stat_file":                        "会读取服务器文件",
+	"pg_ls_dir":                           "会读取服务器文件",
+	"pg_ls_logdir":                        "会读取服务器文件",
+	"pg_ls_waldir":                        "会读取服务器文件",
+	"pg_ls_tmpdir":                        "会读取服务器文件",
+	"pg_ls_archive_statusdir":             "会读取服务器文件",
+	"lo_import":                           "会读取服务器文件",
+	"lo_export":                           "会写入服务器文件",
+	"pg_file_write":                       "会写入服务器文件",
+	"pg_file_rename":                      "会写入服务器文件",
+	"pg_file_unlink":                      "会写入服务器文件",
+	"pg_file_sync":                        "会写入服务器文件",
+	"lo_create":                           "会修改大对象",
+	"lo_creat":                            "会修改大对象",
+	"lo_unlink":                           "会修改大对象",
+	"lo_put":                              "会修改大对象",
+	"lo_from_bytea":                       "会修改大对象",
+	"lowrite":                             "会修改大对象",
+	"pg_terminate_backend":                "会终止其他会话",
+	"pg_cancel_backend":                   "会取消其他会话的查询",
+	"pg_reload_conf":                      "会修改服务器状态",
+	"pg_rotate_logfile":                   "会修改服务器状态",
+	"pg_switch_wal":                       "会修改服务器状态",
+	"pg_create_restore_point":             "会修改服务器状态",
+	"pg_promote":                          "会修改服务器状态",
+	"pg_wal_replay_pause":                 "会修改服务器状态",
+	"pg_wal_replay_resume":                "会修改服务器状态",
+	"pg_create_physical_replication_slot": "会修改服务器状态",
+	"pg_create_logical_replication_slot":  "会修改服务器状态",
+	"pg_drop_replication_slot":            "会修改服务器状态",
+	"pg_logical_emit_message":             "会写入WAL",
+	"set_config":                          "会修改会话配置",
+	"dblink":                              "会连接其他数据库执行语句",
+	"dblink_exec":                         "会连接其他数据库执行语句",
+	"dblink_connect":                      "会连接其他数据库执行语句",
+	"dblink_connect_u":                    "会连接其他数据库执行语句",
+	"dblink_send_query":                   "会连接其他数据库执行语句",
+	"query_to_xml":                        "会执行字符串中的SQL",
+	"query_to_xml_and_xmlschema":          "会执行字符串中的SQL",
+	"query_to_xmlschema":                  "会执行字符串中的SQL",
+	"cursor_to_xml":                       "会读取游标",
+	"nextval":                             "会修改序列",
+	"setval":                              "会修改序列",
+	"pg_notify":                           "会发送通知",
+	"pg_advisory_lock":                    "会获取咨询锁",
+	"pg_advisory_lock_shared":             "会获取咨询锁",
+	"pg_advisory_xact_lock":               "会获取咨询锁",
+	"pg_advisory_xact_lock_shared":        "会获取咨询锁",
+	"pg_try_advisory_lock":                "会获取咨询锁",
+	"pg_try_advisory_lock_shared":         "会获取咨询锁",
+	"pg_try_advisory_xact_lock":           "会获取咨询锁",
+	"pg_try_advisory_xact_lock_shared":    "会获取咨询锁",
+	"pg_advisory_unlock":                  "会释放咨询锁",
+	"pg_advisory_unlock_shared":           "会释放咨询锁",
+	"pg_advisory_unlock_all":              "会释放咨询锁",
+}
+
+var sqliteSideEffectFunctions = map[string]string{
+	"load_extension": "会加载动态库",
+	"readfile":       "会读取服务器文件",
+	"writefile":      "会写入服务器文件",
+	"edit":           "会启动外部编辑器",
+	"fts3_tokenizer": "可以读写任意内存地址",
+}
+
+var sqlserverSideEffectFunctions = map[string]string{
+	"openrowset":     "会连接其他数据源",
+	"opendatasource": "会连接其他数据源",
+	"openquery":      "会在链接服务器上执行语句",
+}
+
+// 检查原始SQL是否为单条只读语句；允许SELECT(含CTE和UNION)、EXPLAIN/DESCRIBE和SHOW，
+// 拒绝时返回原因。非MySQL方言按ANSI_QUOTES模式解析，使双引号表示标识符。
+// 驱动没有整理禁止调用的函数时不允许原始查询
+func checkRawQuery(query, dialect string) error {
+	driver, err := LookupDriver(dialect)
+	if err != nil {
+		return err
+	}
+	if driver.SideEffectFunctions == nil {
+		return fmt.Errorf("拒绝执行: %s 没有配置原始查询中禁止调用的函数，不支持原始SQL", driver.DisplayName)
+	}
+
+	stmts, err := parseSQL(query, dialect)
+	if err != nil {
+		return fmt.Errorf("拒绝执行: 无法按MySQL语法解析SQL: %v", err)
+	}
+	switch len(stmts) {
+	case 0:
+		return fmt.Errorf("拒绝执行: SQL为空")
+	case 1:
+	default:
+		return fmt.Errorf("拒绝执行: 只允许单条语句，收到 %d 条", len(stmts))
+	}
+
+	return checkReadOnlyStatement(stmts[0], driver.SideEffectFunctions)
+}
+
+func parseSQL(query, dialect string) ([]ast.StmtNode, error) {
+	p := parser.New()
+	if dialect != "mysql" {
+		p.SetSQLMode(mysql.ModeANSIQuotes)
+	}
+	stmts, _, err := p.ParseSQL(query)
+	return stmts, err
+}
+
+// 检查原始SQL能否生成执行计划：必须是单条只读的SELECT语句(含CTE和UNION)
+func checkExplainableQuery(query, dialect string) error {
+	if err := checkRawQuery(query, dialect); err != nil {
+		return err
+	}
+	stmts, err := parseSQL(query, dialect)
+	if err != nil {
+		return err
+	}
+	switch stmts[0].(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		return nil
+	case *ast.ExplainStmt:
+		return fmt.Errorf("query 只需要SELECT语句本身，不要带 EXPLAIN")
+	}
+	return fmt.Errorf("只能分析SELECT语句，收到 %s", statementKind(stmts[0]))
+}
+
+func checkReadOnlyStatement(stmt ast.StmtNode, functions map[string]string) error {
+	switch s := stmt.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+	case *ast.ShowStmt:
+		return nil
+	case *ast.ExplainStmt:
+		// EXPLAIN ANALYZE 会真正执行语句，因此被解释的语句同样必须只读
+		return checkReadOnlyStatement(s.Stmt, functions)
+	default:
+		return fmt.Errorf("拒绝执行: 只允许SELECT、EXPLAIN和SHOW语句，收到 %s", statementKind(stmt))
+	}
+
+	checker := &readOnlyChecker{functions: functions}
+	stmt.Accept(checker)
+	return checker.err
+}
+
+// 遍历语法树(含子查询和CTE)，查找有副作用的结构
+type readOnlyChecker struct {
+	functions map[string]string // 禁止调用的函数
+	err       error
+}
+
+func (c *readOnlyChecker) Enter(n ast.Node) (ast.Node, bool) {
+	if c.err != nil {
+		return n, true
+	}
+
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		if node.SelectIntoOpt != nil {
+			c.err = fmt.Errorf("拒绝执行: 不允许使用 SELECT ... INTO 写入文件或变量")
+		} else if node.LockInfo != nil && node.LockInfo.LockType != ast.SelectLockNone {
+			c.err = fmt.Errorf("拒绝执行: 不允许使用 %s 加锁读取", strings.ToUpper(node.LockInfo.LockType.String()))
+		}
+	case *ast.FuncCallExpr:
+		if reason, ok := c.functions[node.FnName.L]; ok {
+			c.err = fmt.Errorf("拒绝执行: 不允许调用函数 %s (%s)", strings.ToUpper(node.FnName.O), reason)
+		}
+	case *ast.VariableExpr:
+		if node.Value != nil {
+			c.err = fmt.Errorf("拒绝执行: 不允许在查询中给变量 @%s 赋值", node.Name)
+		}
+	}
+	return n, c.err != nil
+}
+
+func (c *readOnlyChecker) Leave(n ast.Node) (ast.Node, bool) {
+	return n, c.err == nil
+}
+
+// 返回语句类型的可读名称，如 DELETE、DROP TABLE
+func statementKind(stmt ast.StmtNode) string {
+	switch stmt.(type) {
+	case *ast.InsertStmt:
+		return "INSERT/REPLACE"
+	case *ast.UpdateStmt:
+		return "UPDATE"
+	case *ast.DeleteStmt:
+		return "DELETE"
+	case *ast.DropTableStmt:
+		return "DROP TABLE"
+	case *ast.TruncateTableStmt:
+		return "TRUNCATE"
+	case *ast.CreateTableStmt:
+		return "CREATE TABLE"
+	case *ast.AlterTableStmt:
+		return "ALTER TABLE"
+	case *ast.SetStmt:
+		return "SET"
+	case *ast.LoadDataStmt:
+		return "LOAD DATA"
+	}
+	if _, ok := stmt.(ast.DDLNode); ok {
+		return "DDL语句"
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", stmt), "*ast.")
+}
+
+// 返回SQL中引用的表名(去重，按出现顺序)，CTE名称除外
+func referencedTables(query, dialect string) ([]string, error) {
+	stmts, err := parseSQL(query, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("无法按MySQL语法解析SQL: %v", err)
+	}
+
+	collector := &tableCollector{seen: make(map[string]bool)}
+	for _, stmt := range stmts {
+		stmt.Accept(collector)
+	}
+	return collector.tables, nil
+}
+
+// 按WITH的作用域记录CTE名称：进入带WITH的查询时压入一层，离开时弹出。
+// 非递归的WITH中，CTE名称在它自己的定义结束后才可见，定义中的同名表是真实的表
+type tableCollector struct {
+	tables []string
+	seen   map[string]bool
+	ctes   []map[string]bool
+}
+
+// 返回查询的WITH子句，没有时返回nil
+func withClause(n ast.Node) *ast.WithClause {
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		return node.With
+	case *ast.SetOprStmt:
+		return node.With
+	}
+	return nil
+}
+
+// 名称是否为当前作用域中可见的CTE
+func (c *tableCollector) isCTE(name string) bool {
+	for _, scope := range c.ctes {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *tableCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if with := withClause(n); with != nil {
+		scope := make(map[string]bool)
+		if with.IsRecursive {
+			for _, cte := range with.CTEs {
+				scope[cte.Name.L] = true
+			}
+		}
+		c.ctes = append(c.ctes, scope)
+	}
+
+	if node, ok := n.(*ast.TableName); ok {
+		if node.Schema.O == "" && c.isCTE(node.Name.L) {
+			return n, false
+		}
+		name := node.Name.O
+		if node.Schema.O != "" {
+			name = node.Schema.O + "." + name
+		}
+		if !c.seen[name] {
+			c.seen[name] = true
+			c.tables = append(c.tables, name)
+		}
+	}
+	return n, false
+}
+
+func (c *tableCollector) Leave(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.CommonTableExpression:
+		// 定义结束后，名称对之后的CTE和查询主体可见
+		c.ctes[len(c.ctes)-1][node.Name.L] = true
+	default:
+		if withClause(n) != nil {
+			c.ctes = c.ctes[:len(c.ctes)-1]
+		}
+	}
+	return n, true
+}
+
+// tableColumn 条件中引用的表中的一列
+type tableColumn struct {
+	table  string
+	column string
+	join   bool // 只出现在JOIN的ON条件中
+}
+
+// 返回SQL的WHERE和JOIN ON条件中引用的列(去重，按出现顺序)，以及表别名(小写)到表名的映射；
+// 多表查询中没有限定表名的列无法确定所属的表，被忽略
+func filterColumns(query, dialect string) ([]tableColumn, map[string]string, error) {
+	stmts, err := parseSQL(query, dialect)
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法按MySQL语法解析SQL: %v", err)
+	}
+	collector := &filterColumnCollector{seen: make(map[string]bool), aliases: make(map[string]string)}
+	for _, stmt := range stmts {
+		stmt.Accept(collector)
+	}
+	return collector.columns, collector.aliases, nil
+}
+
+type filterColumnCollector struct {
+	columns []tableColumn
+	seen    map[string]bool // 小写的 表名.列名
+	aliases map[string]string
+}
+
+// 每个SELECT单独处理，子查询由遍历继续进入
+func (c *filterColumnCollector) Enter(n ast.Node) (ast.Node, bool) {
+	selectStmt, ok := n.(*ast.SelectStmt)
+	if !ok || selectStmt.From == nil {
+		return n, false
+	}
+
+	tables := make(map[string]string) // 小写的别名或表名 -> 表名
+	var names []string
+	var joinConditions []ast.ExprNode
+	collectTableSources(selectStmt.From.TableRefs, tables, &names, &joinConditions)
+	for alias, table := range tables {
+		c.aliases[alias] = table
+	}
+
+	// 先收集WHERE中的列，同时出现在ON条件中的列不标记为join
+	visit := func(condition ast.ExprNode, join bool) {
+		condition.Accept(&columnRefCollector{visit: func(name *ast.ColumnName) {
+			table := tables[name.Table.L]
+			if name.Table.L == "" && len(names) == 1 {
+				table = names[0]
+			}
+			key := strings.ToLower(table + "." + name.Name.O)
+			if table == "" || c.seen[key] {
+				return
+			}
+			c.seen[key] = true
+			c.columns = append(c.columns, tableColumn{table: table, column: name.Name.O, join: join})
+		}})
+	}
+	if selectStmt.Where != nil {
+		visit(selectStmt.Where, false)
+	}
+	for _, condition := range joinConditions {
+		visit(condition, true)
+	}
+	return n, false
+}
+
+func (c *filterColumnCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// 收集FROM子句中的表(含别名)和JOIN的ON条件；派生表和库名限定的表不计入
+func collectTableSources(node ast.ResultSetNode, tables map[string]string, names *[]string, conditions *[]ast.ExprNode) {
+	switch source := node.(type) {
+	case *ast.Join:
+		if source.Left != nil {
+			collectTableSources(source.Left, tables, names, conditions)
+		}
+		if source.Right != nil {
+			collectTableSources(source.Right, tables, names, conditions)
+		}
+		if source.On != nil {
+			*conditions = append(*conditions, source.On.Expr)
+		}
+	case *ast.TableSource:
+		table, ok := source.Source.(*ast.TableName)
+		if !ok || table.Schema.O != "" {
+			return
+		}
+		tables[table.Name.L] = table.Name.O
+		if source.AsName.L != "" {
+			tables[source.AsName.L] = table.Name.O
+		}
+		*names = append(*names, table.Name.O)
+	}
+}
+
+// 遍历条件表达式中的列引用，不进入子查询
+type columnRefCollector struct {
+	visit func(name *ast.ColumnName)
+}
+
+func (c *columnRefCollector) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.SubqueryExpr:
+		return n, true
+	case *ast.ColumnNameExpr:
+		c.visit(node.Name)
+	}
+	return n, false
+}
+
+func (c *columnRefCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
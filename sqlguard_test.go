@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRawQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		query   string
+		wantErr string // 为空表示应当放行
+	}{
+		{"select", "mysql", "SELECT id, name FROM users WHERE status = 'active'", ""},
+		{"cte", "postgres", `WITH t AS (SELECT id FROM "users") SELECT * FROM t`, ""},
+		{"union", "sqlite", "SELECT id FROM users UNION SELECT user_id FROM orders", ""},
+		{"show", "mysql", "SHOW TABLES", ""},
+		{"explain", "mysql", "EXPLAIN SELECT * FROM users", ""},
+		{"empty", "mysql", "  ", "SQL为空"},
+		{"multiple statements", "mysql", "SELECT 1; SELECT 2", "只允许单条语句"},
+		{"delete", "mysql", "DELETE FROM users", "拒绝执行"},
+		{"update", "sqlite", "UPDATE users SET name = 'x'", "拒绝执行"},
+		{"drop", "postgres", "DROP TABLE users", "拒绝执行"},
+		{"select into outfile", "mysql", "SELECT * FROM users INTO OUTFILE '/tmp/users'", "拒绝执行"},
+		{"select for update", "mysql", "SELECT * FROM users FOR UPDATE", "拒绝执行"},
+		{"mysql sleep", "mysql", "SELECT SLEEP(10)", "sleep"},
+		{"mysql sleep in subquery", "mysql", "SELECT * FROM users WHERE id IN (SELECT SLEEP(1))", "sleep"},
+		{"mysql get_lock", "mysql", "SELECT GET_LOCK('a', 10)", "get_lock"},
+		{"postgres pg_sleep", "postgres", "SELECT pg_sleep(10)", "pg_sleep"},
+		{"postgres pg_read_file", "postgres", "SELECT pg_read_file('/etc/passwd')", "pg_read_file"},
+		{"postgres pg_terminate_backend", "postgres", "SELECT pg_terminate_backend(1)", "pg_terminate_backend"},
+		{"postgres set_config", "postgres", "SELECT set_config('role', 'admin', false)", "set_config"},
+		{"postgres dblink_exec", "postgres", "SELECT dblink_exec('conn', 'DROP TABLE users')", "dblink_exec"},
+		{"postgres sleep is allowed as a column", "postgres", "SELECT sleep FROM users", ""},
+		{"sqlite load_extension", "sqlite", "SELECT load_extension('/tmp/evil.so')", "load_extension"},
+		{"sqlserver openrowset", "sqlserver", "SELECT * FROM OPENROWSET('a', 'b', 'c')", "拒绝执行"},
+		{"unknown driver", "oracle", "SELECT 1", "不支持的数据库驱动"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRawQuery(tt.query, tt.dialect)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("checkRawQuery(%q) = %v，应当放行", tt.query, err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("checkRawQuery(%q) 放行了，应当拒绝(%s)", tt.query, tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(strings.ToLower(err.Error()), strings.ToLower(tt.wantErr)):
+				t.Fatalf("checkRawQuery(%q) = %v，应包含 %q", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReferencedTables(t *testing.T) {
+	tests := []struct {
+		dialect string
+		query   string
+		want    []string
+	}{
+		{"mysql", "SELECT * FROM users", []string{"users"}},
+		{"sqlite", "SELECT u.name, o.amount FROM users u JOIN orders o ON o.user_id = u.id", []string{"users", "orders"}},
+		{"postgres", `SELECT * FROM "users" WHERE id IN (SELECT user_id FROM orders)`, []string{"users", "orders"}},
+		{"postgres", "SELECT * FROM public.users", []string{"public.users"}},
+		{"mysql", "WITH t AS (SELECT id FROM users) SELECT * FROM t", []string{"users"}},
+		{"mysql", "WITH a AS (SELECT id FROM users), b AS (SELECT * FROM a) SELECT * FROM b", []string{"users"}},
+		{"sqlite", "WITH t AS (SELECT id FROM users) SELECT * FROM t UNION SELECT id FROM t", []string{"users"}},
+		{"postgres", "WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 3) SELECT * FROM t", nil},
+		// CTE的定义中引用的同名表是真实的表
+		{"postgres", "WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", []string{"secrets"}},
+		// 子查询中的CTE名称在子查询之外不可见
+		{"mysql", "SELECT * FROM (WITH secrets AS (SELECT 1 AS x) SELECT * FROM secrets) a, secrets", []string{"secrets"}},
+	}
+	for _, tt := range tests {
+		got, err := referencedTables(tt.query, tt.dialect)
+		if err != nil {
+			t.Fatalf("referencedTables(%q): %v", tt.query, err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("referencedTables(%q) = %v，期望 %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 执行 KILL QUERY 的最长等待时间
+const killQueryTimeout = 5 * time.Second
+
+// 查询的超时时间：调用方指定的 timeoutMs 不能超过连接配置的 query_timeout，
+// 连接未配置时以全局的 query.timeout 为上限；均为0时不限
+func queryTimeout(config DatabaseConfig, timeoutMs int) time.Duration {
+	limit := time.Duration(config.QueryTimeout)
+	if limit <= 0 {
+		limit = time.Duration(appConfig.Query.Timeout)
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if timeout <= 0 || (limit > 0 && timeout > limit) {
+		return limit
+	}
+	return timeout
+}
+
+// 在超时和取消控制下执行查询，fn 中的数据库操作都要使用传入的 tx。
+// MySQL 驱动在取消时只断开客户端连接，服务端的语句仍会继续执行，因此固定使用一个连接，
+// 超时或取消时在另一个连接上对它执行 KILL QUERY；其他驱动会自行通知服务端取消
+func runQuery(ctx context.Context, db *gorm.DB, timeout time.Duration, fn func(tx *gorm.DB) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var err error
+	if db.Dialector.Name() == "mysql" {
+		err = db.WithContext(ctx).Connection(func(tx *gorm.DB) error {
+			var connectionID int64
+			if err := tx.Session(&gorm.Session{NewDB: true}).Raw("SELECT CONNECTION_ID()").Scan(&connectionID).Error; err != nil {
+				return err
+			}
+
+			done := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				select {
+				case <-done:
+				case <-ctx.Done():
+					killQuery(db, connectionID)
+				}
+			}()
+
+			// 等待监视协程退出后再归还连接，避免 KILL 误伤之后复用该连接的查询
+			err := fn(tx.Session(&gorm.Session{NewDB: true}))
+			close(done)
+			<-stopped
+			return err
+		})
+	} else {
+		err = fn(db.WithContext(ctx))
+	}
+
+	if err != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return fmt.Errorf("查询超过 %s 未完成，已取消", timeout)
+		case context.Canceled:
+			return errors.New("查询已被取消")
+		}
+	}
+	return err
+}
+
+// 终止MySQL连接上正在执行的语句，连接本身保留
+func killQuery(db *gorm.DB, connectionID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), killQueryTimeout)
+	defer cancel()
+
+	if err := db.WithContext(ctx).Exec(fmt.Sprintf("KILL QUERY %d", connectionID)).Error; err != nil {
+		log.Printf("终止MySQL查询(连接 %d)失败: %v", connectionID, err)
+		return
+	}
+	log.Printf("已终止超时或被取消的MySQL查询(连接 %d)", connectionID)
+}
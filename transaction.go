@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gorm.io/gorm"
+)
+
+// 单个事务中最多包含的操作数
+const maxTransactionSteps = 100
+
+// 事务中每一步的状态
+const (
+	stepCommitted  = "committed"   // 已执行，事务已提交
+	stepRolledBack = "rolled_back" // 已执行，但事务被回滚
+	stepFailed     = "failed"      // 执行失败，导致事务回滚
+	stepSkipped    = "skipped"     // 前面的步骤失败，未执行
+)
+
+// 事务步骤中允许的参数，与 database_query 的结构化查询参数相同
+var transactionStepArgs = map[string]bool{
+	"query":            true,
+	"table_name":       true,
+	"fields":           true,
+	"where_conditions": true,
+	"order_by":         true,
+	"limit":            true,
+	"offset":           true,
+	"group_by":         true,
+	"having":           true,
+	"join_tables":      true,
+	"on_conflict":      true,
+	"conflict_columns": true,
+	"update_columns":   true,
+	"batch_size":       true,
+}
+
+// TransactionResult database_transaction 的结构化结果
+type TransactionResult struct {
+	Database  string            `json:"database" jsonschema:"description=数据库连接名称"`
+	Committed bool              `json:"committed" jsonschema:"description=事务是否已提交"`
+	Error     string            `json:"error,omitempty" jsonschema:"description=事务回滚的原因"`
+	Steps     []TransactionStep `json:"steps" jsonschema:"description=按顺序排列的各步骤结果"`
+}
+
+// TransactionStep 事务中一步操作的结果
+type TransactionStep struct {
+	Step      int          `json:"step" jsonschema:"description=步骤序号，从1开始"`
+	Operation string       `json:"operation"`
+	Table     string       `json:"table"`
+	Status    string       `json:"status" jsonschema:"enum=committed,enum=rolled_back,enum=failed,enum=skipped"`
+	Error     string       `json:"error,omitempty"`
+	Result    *QueryResult `json:"result,omitempty"`
+}
+
+// 注册事务工具
+func registerTransactionTools(s *server.MCPServer) {
+	transactionTool := mcp.NewTool("database_transaction",
+		mcp.WithDescription("在一个事务中按顺序执行多个结构化操作，任一步失败时全部回滚"),
+		mcp.WithString("database",
+			mcp.DefaultString("default"),
+			mcp.Description("数据库连接名称"),
+		),
+		mcp.WithArray("operations",
+			mcp.Required(),
+			mcp.Description("按顺序执行的操作，每项的参数与 database_query 的结构化查询相同，如 "+
+				`[{"query":"update","table_name":"accounts","fields":"{\"balance\":90}","where_conditions":"id=1"},`+
+				`{"query":"insert","table_name":"transfers","fields":"{\"from_id\":1,\"amount\":10}"}]`+
+				"；query 可选 select/count/insert/update/delete，fields/where_conditions/join_tables 也可以直接写成JSON对象或数组"),
+			mcp.Items(map[string]any{"type": "object"}),
+		),
+		mcp.WithNumber("timeout_ms",
+			mcp.Description("整个事务的超时时间(毫秒)，不能超过连接配置的上限"),
+		),
+		mcp.WithString("confirm_token",
+			mcp.Description("写操作或代价超限的查询需要确认时返回的确认令牌，取得用户同意后与原参数一起传回"),
+		),
+		mcp.WithOutputSchema[TransactionResult](),
+	)
+	addTool(s, transactionTool, handleDatabaseTransaction)
+}
+
+// transactionStep 解析后的一步操作
+type transactionStep struct {
+	operation string
+	table     string
+	request   mcp.CallToolRequest
+}
+
+// 解析 operations 参数，每一步都转换成 database_query 的结构化查询请求
+func parseTransactionSteps(value interface{}) ([]transactionStep, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("operations 必须是非空数组")
+	}
+	if len(items) > maxTransactionSteps {
+		return nil, fmt.Errorf("operations 最多包含 %d 个操作，收到 %d 个", maxTransactionSteps, len(items))
+	}
+
+	steps := make([]transactionStep, 0, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operations[%d]: 必须是对象", i)
+		}
+
+		args := make(map[string]interface{}, len(object))
+		for key, v := range object {
+			if !transactionStepArgs[key] {
+				return nil, fmt.Errorf("operations[%d]: 不支持的参数 %q", i, key)
+			}
+			// 结构化参数在 database_query 中是JSON字符串，这里也接受直接写成的对象或数组
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				data, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("operations[%d].%s: %v", i, key, err)
+				}
+				v = string(data)
+			}
+			args[key] = v
+		}
+
+		step := transactionStep{}
+		step.request.Params.Name = "database_query"
+		step.request.Params.Arguments = args
+		step.operation = strings.ToLower(step.request.GetString("query", ""))
+		step.table = step.request.GetString("table_name", "")
+		switch step.operation {
+		case "select", "count", "insert", "update", "delete":
+		case "":
+			return nil, fmt.Errorf("operations[%d]: 缺少 query", i)
+		default:
+			return nil, fmt.Errorf("operations[%d]: 不支持的操作 %q，可选值: select, count, insert, update, delete", i, step.operation)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func handleDatabaseTransaction(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	database := request.GetString("database", "default")
+	steps, err := parseTransactionSteps(request.GetArguments()["operations"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	timeoutMs := request.GetInt("timeout_ms", 0)
+	if timeoutMs < 0 {
+		return mcp.NewToolResultError("timeout_ms 不能为负数"), nil
+	}
+
+	// 执行前检查所有步骤的权限，避免执行到一半才被拒绝
+	for _, step := range steps {
+		if err := authorizeQuery(ctx, database, step.operation); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkAuditTableWrite(database, step.operation, step.table); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	db, err := dbManager.GetConnection(database)
+	if err != nil {
+		return databaseErrorResult(err), nil
+	}
+	config, err := dbManager.ConnectionConfig(database)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	policy := newAccessPolicy(database, config)
+	for i, step := range steps {
+		if err := policy.checkStructured(step.operation, step.table, step.request.GetString("join_tables", "")); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("operations[%d]: %v", i, auditDenied(ctx, err))), nil
+		}
+	}
+
+	// 某一步影响的记录数或 select 的估计代价超过阈值时回滚，请用户确认后重新执行整个事务
+	claims, err := acceptConfirmToken(ctx, "database_transaction", database, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	guard := newWriteGuard(database, config)
+	guard.confirmed = claims.Rows
+	costs := newCostGuard(database, config)
+	costs.confirmed = claims.Cost
+	timeout := queryTimeout(config, timeoutMs)
+	for {
+		result, err := runTransaction(ctx, db, timeout, database, steps, guard, costs, policy)
+		confirmed := confirmClaims{Rows: guard.confirmed, Cost: costs.confirmed}
+		var need *ConfirmationRequiredError
+		if errors.As(err, &need) {
+			if denied := requestConfirmation(ctx, "database_transaction", request.GetArguments(), need, confirmed); denied != nil {
+				return denied, nil
+			}
+			guard.confirmed = need.Rows
+			continue
+		}
+		var costly *CostLimitError
+		if errors.As(err, &costly) && costs.confirm {
+			if denied := requestConfirmation(ctx, "database_transaction", request.GetArguments(), costly, confirmed); denied != nil {
+				return denied, nil
+			}
+			costs.confirmed = &costly.Rows
+			continue
+		}
+
+		if err != nil {
+			toolResult := mcp.NewToolResultStructured(result, result.text())
+			toolResult.IsError = true
+			return toolResult, nil
+		}
+		return mcp.NewToolResultStructured(result, result.text()), nil
+	}
+}
+
+// 执行 select 步骤前检查其估计代价，超过阈值时返回 *CostLimitError
+func checkStepCost(db *gorm.DB, step transactionStep, costs *costGuard, policy *accessPolicy) error {
+	if !costs.applies("structured", step.operation) {
+		return nil
+	}
+	plan, err := costs.plan(db, "structured", step.request, policy)
+	if err != nil {
+		return err
+	}
+	var need *CostLimitError
+	if err := costs.check(plan); errors.As(err, &need) && !costs.confirm {
+		return errors.New(need.rejected())
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// 在一个事务中依次执行各步骤，失败时返回的结果中记录了各步骤的状态
+func runTransaction(ctx context.Context, db *gorm.DB, timeout time.Duration, database string, steps []transactionStep, guard *writeGuard, costs *costGuard, policy *accessPolicy) (*TransactionResult, error) {
+	result := &TransactionResult{Database: database, Steps: make([]TransactionStep, len(steps))}
+	for i, step := range steps {
+		result.Steps[i] = TransactionStep{Step: i + 1, Operation: step.operation, Table: step.table, Status: stepSkipped}
+	}
+
+	err := runQuery(ctx, db, timeout, func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			for i, step := range steps {
+				var stepResult *QueryResult
+				err := checkStepCost(tx, step, costs, policy)
+				if err == nil {
+					stepResult, err = executeStructuredQuery(tx, step.request, newPageRequest(0, 0), policy)
+				}
+				if err == nil {
+					err = guard.checkResult(step.operation, stepResult)
+				}
+				if err != nil {
+					result.Steps[i].Status = stepFailed
+					result.Steps[i].Error = err.Error()
+					return fmt.Errorf("第 %d 步 %s %s 失败: %w", i+1, step.operation, step.table, err)
+				}
+				stepResult.Database = database
+				result.Steps[i].Status = stepCommitted
+				result.Steps[i].Result = stepResult
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		for i := range result.Steps {
+			if result.Steps[i].Status == stepCommitted {
+				result.Steps[i].Status = stepRolledBack
+			}
+		}
+		result.Error = err.Error()
+		return result, err
+	}
+
+	result.Committed = true
+	return result, nil
+}
+
+// 文本内容：事务结果和每一步的摘要
+func (r *TransactionResult) text() string {
+	var text strings.Builder
+	if r.Committed {
+		text.WriteString(fmt.Sprintf("事务已提交，共 %d 步：\n", len(r.Steps)))
+	} else {
+		text.WriteString(fmt.Sprintf("事务已回滚: %s\n", r.Error))
+	}
+
+	for _, step := range r.Steps {
+		text.WriteString(fmt.Sprintf("%d. %s %s [%s]", step.Step, step.Operation, step.Table, step.Status))
+		switch {
+		case step.Error != "":
+			text.WriteString(": " + step.Error)
+		case step.Result != nil:
+			text.WriteString(": " + strings.TrimRight(step.Result.summary, ":："))
+		}
+		text.WriteString("\n")
+	}
+	return strings.TrimSuffix(text.String(), "\n")
+}
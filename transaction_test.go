@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []interface{}
+		committed  bool
+		statuses   []string
+		wantErr    string
+		users      int64 // 事务结束后未删除的用户数
+		orders     int64 // 事务结束后 user_id=1 的订单金额之和
+	}{
+		{
+			name: "commit",
+			operations: []interface{}{
+				map[string]interface{}{"query": "insert", "table_name": "users", "fields": map[string]interface{}{"name": "赵六", "email": "zhaoliu@example.com"}},
+				map[string]interface{}{"query": "update", "table_name": "orders", "fields": `{"amount":0}`, "where_conditions": "user_id=1"},
+				map[string]interface{}{"query": "count", "table_name": "users"},
+			},
+			committed: true,
+			statuses:  []string{stepCommitted, stepCommitted, stepCommitted},
+			users:     4,
+			orders:    0,
+		},
+		{
+			name: "unknown column rolls back earlier steps",
+			operations: []interface{}{
+				map[string]interface{}{"query": "insert", "table_name": "users", "fields": map[string]interface{}{"name": "赵六", "email": "zhaoliu@example.com"}},
+				map[string]interface{}{"query": "update", "table_name": "orders", "fields": `{"amount":0}`, "where_conditions": "user_id=1"},
+				map[string]interface{}{"query": "update", "table_name": "orders", "fields": `{"total":0}`, "where_conditions": "user_id=1"},
+				map[string]interface{}{"query": "delete", "table_name": "orders", "where_conditions": "user_id=3"},
+			},
+			statuses: []string{stepRolledBack, stepRolledBack, stepFailed, stepSkipped},
+			wantErr:  "第 3 步 update orders 失败",
+			users:    3,
+			orders:   350,
+		},
+		{
+			name: "constraint violation rolls back",
+			operations: []interface{}{
+				map[string]interface{}{"query": "delete", "table_name": "orders", "where_conditions": "user_id=1"},
+				map[string]interface{}{"query": "insert", "table_name": "users", "fields": `{"name":"重复","email":"zhangsan@example.com"}`},
+			},
+			statuses: []string{stepRolledBack, stepFailed},
+			wantErr:  "第 2 步 insert users 失败",
+			users:    3,
+			orders:   350,
+		},
+		{
+			name: "unsupported step argument",
+			operations: []interface{}{
+				map[string]interface{}{"query": "delete", "table_name": "orders", "where_conditions": "user_id=1", "include_deleted": true},
+			},
+			wantErr: "不支持的参数",
+			users:   3,
+			orders:  350,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDatabase(t, DatabaseConfig{})
+			request := newTestRequest("database_transaction", map[string]interface{}{"operations": tt.operations})
+			result, err := handleDatabaseTransaction(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != "" && (!result.IsError || !strings.Contains(resultText(result), tt.wantErr)) {
+				t.Fatalf("结果 %q 应为包含 %q 的错误", resultText(result), tt.wantErr)
+			}
+			if tt.wantErr == "" && result.IsError {
+				t.Fatalf("意外的错误: %s", resultText(result))
+			}
+			if content, ok := result.StructuredContent.(*TransactionResult); ok {
+				var statuses []string
+				for _, step := range content.Steps {
+					statuses = append(statuses, step.Status)
+				}
+				if content.Committed != tt.committed || !reflect.DeepEqual(statuses, tt.statuses) {
+					t.Fatalf("committed=%v 步骤状态=%v，期望 committed=%v %v", content.Committed, statuses, tt.committed, tt.statuses)
+				}
+			} else if tt.statuses != nil {
+				t.Fatalf("缺少结构化的事务结果: %s", resultText(result))
+			}
+
+			if count := countTestRows(t, "users", "deleted_at IS NULL"); count != tt.users {
+				t.Errorf("用户数 = %d，期望 %d", count, tt.users)
+			}
+			if total := sumTestOrders(t); total != tt.orders {
+				t.Errorf("user_id=1 的订单金额之和 = %d，期望 %d", total, tt.orders)
+			}
+		})
+	}
+}
+
+func TestDatabaseTransactionConfirmation(t *testing.T) {
+	newTestDatabase(t, DatabaseConfig{ConfirmThreshold: 1, ConfirmOperations: []string{"delete"}})
+	operations := []interface{}{
+		map[string]interface{}{"query": "update", "table_name": "orders", "fields": `{"note":"x"}`, "where_conditions": "user_id=1"},
+		map[string]interface{}{"query": "delete", "table_name": "orders", "where_conditions": "user_id=1"},
+	}
+
+	// 删除的记录数超过阈值时整个事务回滚，并返回确认令牌
+	result, err := handleDatabaseTransaction(context.Background(), newTestRequest("database_transaction", map[string]interface{}{"operations": operations}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := resultText(result)
+	if !result.IsError || !strings.Contains(text, "confirm_token=") {
+		t.Fatalf("超过阈值的事务应返回确认令牌，实际: %s", text)
+	}
+	if count := countTestRows(t, "orders", "note = 'x'"); count != 0 {
+		t.Fatalf("确认前已修改 %d 条订单，事务应当回滚", count)
+	}
+
+	token := strings.TrimSpace(text[strings.LastIndex(text, "confirm_token=")+len("confirm_token="):])
+	request := newTestRequest("database_transaction", map[string]interface{}{"operations": operations, "confirm_token": token})
+	if result, err = handleDatabaseTransaction(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("带令牌重新执行失败: %s", resultText(result))
+	}
+	if count := countTestRows(t, "orders", "user_id = 1"); count != 0 {
+		t.Fatalf("确认后仍有 %d 条 user_id=1 的订单", count)
+	}
+}
+
+// 连接 default 中 user_id=1 的订单金额之和
+func sumTestOrders(t *testing.T) int64 {
+	t.Helper()
+	db, err := dbManager.GetConnection("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	if err := db.Raw("SELECT COALESCE(SUM(amount), 0) FROM orders WHERE user_id = 1").Scan(&total).Error; err != nil {
+		t.Fatal(err)
+	}
+	return total
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 支持的传输方式
+const (
+	transportStdio = "stdio"
+	transportSSE   = "sse"
+	transportHTTP  = "http" // streamable HTTP
+)
+
+// TransportConfig 传输方式配置；sse和http传输监听Address，端点挂在BasePath下
+type TransportConfig struct {
+	Type            string   `json:"type" yaml:"type" toml:"type"`
+	Address         string   `json:"address" yaml:"address" toml:"address"`
+	BasePath        string   `json:"base_path" yaml:"base_path" toml:"base_path"`
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+func (c TransportConfig) validate() error {
+	var errs []error
+	switch c.Type {
+	case transportStdio, transportSSE, transportHTTP:
+	default:
+		errs = append(errs, fmt.Errorf("transport.type: 不支持的传输方式 %q，可选值: stdio, sse, http", c.Type))
+	}
+	if c.Type != transportStdio {
+		if c.Address == "" {
+			errs = append(errs, fmt.Errorf("transport.address: %s 传输必须指定监听地址", c.Type))
+		}
+		if !strings.HasPrefix(c.BasePath, "/") {
+			errs = append(errs, fmt.Errorf("transport.base_path: 必须以 / 开头"))
+		}
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("transport.shutdown_timeout: 不能为负数"))
+	}
+	return errors.Join(errs...)
+}
+
+// 按配置的传输方式运行服务器，直到ctx被取消或传输出错；auth只作用于sse和http传输
+func serve(ctx context.Context, s *server.MCPServer, config TransportConfig, auth AuthConfig) error {
+	if config.Type == transportStdio {
+		log.Println("使用stdio传输")
+		stdioServer := server.NewStdioServer(s)
+		stdioServer.SetErrorLogger(log.Default())
+		err := stdioServer.Listen(ctx, os.Stdin, os.Stdout)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	}
+
+	basePath := strings.TrimRight(config.BasePath, "/")
+	httpServer := &http.Server{
+		Addr:              config.Address,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+
+	protect := func(h http.Handler) http.Handler { return h }
+	if auth.Enabled() {
+		protect = func(h http.Handler) http.Handler { return requireAuth(auth, h) }
+		log.Printf("已启用认证，共 %d 个凭据", len(auth.Credentials))
+	} else {
+		log.Printf("警告: 未配置认证凭据，%s 传输将接受任何客户端的请求", config.Type)
+	}
+
+	var shutdown func(context.Context) error
+	switch config.Type {
+	case transportSSE:
+		sseServer := server.NewSSEServer(s,
+			server.WithBasePath(basePath),
+			server.WithUseFullURLForMessageEndpoint(false),
+			server.WithKeepAlive(true),
+			server.WithHTTPServer(httpServer),
+		)
+		mux.Handle(basePath+"/", protect(sseServer))
+		shutdown = sseServer.Shutdown
+		log.Printf("使用SSE传输，监听 %s，SSE端点 %s，消息端点 %s",
+			config.Address, sseServer.CompleteSsePath(), sseServer.CompleteMessagePath())
+	case transportHTTP:
+		httpHandler := server.NewStreamableHTTPServer(s,
+			server.WithEndpointPath(basePath),
+			server.WithStreamableHTTPServer(httpServer),
+		)
+		mux.Handle(basePath, protect(httpHandler))
+		shutdown = httpHandler.Shutdown
+		log.Printf("使用streamable HTTP传输，监听 %s，端点 %s", config.Address, basePath)
+	}
+	httpServer.Handler = mux
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := time.Duration(config.ShutdownTimeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	log.Printf("正在关闭HTTP服务器，最长等待 %s...", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("关闭HTTP服务器失败: %v", err)
+	}
+	return nil
+}
+
+// 供容器探活使用的HTTP健康检查，不需要认证，因此只返回总体状态(ok/degraded)；
+// 数据库不可用不影响其他工具，因此始终返回200
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	health := dbManager.Health(r.Context(), false, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": health.Status})
+}
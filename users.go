@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 用户状态的可选值
+const (
+	userActive   = "active"
+	userInactive = "inactive"
+)
+
+var userStatuses = []string{userActive, userInactive}
+
+// 用户名和邮箱的最大长度，与表结构一致
+const (
+	maxUserNameLength  = 100
+	maxUserEmailLength = 100
+)
+
+// create/update 可写入的字段
+var userWritableFields = []string{"name", "email", "status"}
+
+func init() {
+	RegisterModel(ModelDefinition{
+		Name:        "users",
+		Description: "用户",
+		Model:       &User{},
+		Operations: []ModelOperation{
+			{Name: "all", Description: "所有用户，同list"},
+			{Name: "active", Description: "状态为active的用户", Scope: func(db *gorm.DB) *gorm.DB {
+				return db.Where("status = ?", userActive)
+			}},
+			{Name: "inactive", Description: "状态为inactive的用户", Scope: func(db *gorm.DB) *gorm.DB {
+				return db.Where("status = ?", userInactive)
+			}},
+			{Name: "recent", Description: "最近创建的10个用户", Limit: 10, Scope: func(db *gorm.DB) *gorm.DB {
+				return db.Order("created_at DESC")
+			}},
+			{Name: "by_email", Description: `按邮箱查找用户，where_conditions: {"email":"..."}`, Execute: findUserByEmail},
+			{Name: "create", Description: `创建用户，fields: {"name":"...","email":"...","status":"active"}`, Kind: "insert", Execute: createUser},
+			{Name: "update", Description: `修改用户，where_conditions: {"id":1} 或 {"email":"..."}，fields 为要修改的 name/email/status`, Kind: "update", Execute: updateUser},
+			{Name: "deactivate", Description: "停用用户，where_conditions 同update", Kind: "update", Execute: setUserStatus(userInactive)},
+			{Name: "reactivate", Description: "重新启用用户，where_conditions 同update", Kind: "update", Execute: setUserStatus(userActive)},
+		},
+		Filters:    []string{"id", "name", "email", "status", "created_at", "updated_at"},
+		SortFields: []string{"id", "name", "email", "status", "created_at", "updated_at"},
+	})
+}
+
+// 按邮箱查找用户
+func findUserByEmail(db *gorm.DB, input ModelInput) (*QueryResult, error) {
+	email, ok := input.Where["email"].(string)
+	if !ok || len(input.Where) != 1 {
+		return nil, fmt.Errorf(`by_email 需要 where_conditions: {"email":"..."}`)
+	}
+	user, err := findUser(db, map[string]interface{}{"email": email})
+	if err != nil {
+		return nil, err
+	}
+	return userResult(db, "by_email", user.ID, nil, fmt.Sprintf("找到用户 #%d", user.ID))
+}
+
+// 创建用户；status 默认为 active
+func createUser(db *gorm.DB, input ModelInput) (*QueryResult, error) {
+	if len(input.Where) > 0 {
+		return nil, fmt.Errorf("create 不使用 where_conditions")
+	}
+	user := User{Status: userActive}
+	if err := applyUserFields(&user, input.Fields); err != nil {
+		return nil, err
+	}
+	if user.Name == "" || user.Email == "" {
+		return nil, fmt.Errorf("create 必须提供 name 和 email")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkEmailAvailable(tx, user.Email, 0); err != nil {
+			return err
+		}
+		return userWriteError(tx, tx.Create(&user).Error, user.Email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows := int64(1)
+	return userResult(db, "create", user.ID, &rows, fmt.Sprintf("已创建用户 #%d", user.ID))
+}
+
+// 修改用户的 name/email/status
+func updateUser(db *gorm.DB, input ModelInput) (*QueryResult, error) {
+	if len(input.Fields) == 0 {
+		return nil, fmt.Errorf("update 必须在 fields 中提供要修改的字段: %s", strings.Join(userWritableFields, ", "))
+	}
+
+	var user *User
+	var rows int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user, err = findUser(tx, input.Where); err != nil {
+			return err
+		}
+		updated := *user
+		if err := applyUserFields(&updated, input.Fields); err != nil {
+			return err
+		}
+		if updated.Email != user.Email {
+			if err := checkEmailAvailable(tx, updated.Email, user.ID); err != nil {
+				return err
+			}
+		}
+		result := tx.Model(user).Select(userWritableFields).Updates(&updated)
+		rows = result.RowsAffected
+		return userWriteError(tx, result.Error, updated.Email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userResult(db, "update", user.ID, &rows, fmt.Sprintf("已修改用户 #%d", user.ID))
+}
+
+// 停用或重新启用用户，状态已经相同时不做修改
+func setUserStatus(status string) func(db *gorm.DB, input ModelInput) (*QueryResult, error) {
+	operation := "reactivate"
+	if status == userInactive {
+		operation = "deactivate"
+	}
+	return func(db *gorm.DB, input ModelInput) (*QueryResult, error) {
+		if len(input.Fields) > 0 {
+			return nil, fmt.Errorf("%s 不使用 fields", operation)
+		}
+
+		var user *User
+		var rows int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if user, err = findUser(tx, input.Where); err != nil {
+				return err
+			}
+			if user.Status == status {
+				return nil
+			}
+			result := tx.Model(user).Update("status", status)
+			rows = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		summary := fmt.Sprintf("用户 #%d 的状态已改为 %s", user.ID, status)
+		if rows == 0 {
+			summary = fmt.Sprintf("用户 #%d 的状态已经是 %s，未做修改", user.ID, status)
+		}
+		return userResult(db, operation, user.ID, &rows, summary)
+	}
+}
+
+// 按 {"id":1} 或 {"email":"..."} 查找唯一的用户
+func findUser(db *gorm.DB, where map[string]interface{}) (*User, error) {
+	if len(where) != 1 {
+		return nil, fmt.Errorf(`where_conditions 必须且只能指定 id 或 email 之一，如 {"id":1} 或 {"email":"a@example.com"}`)
+	}
+
+	var user User
+	var query *gorm.DB
+	var target string
+	switch {
+	case where["id"] != nil:
+		id, ok := where["id"].(float64)
+		if !ok || id <= 0 || id != float64(uint(id)) {
+			return nil, fmt.Errorf("id 必须是正整数")
+		}
+		query = db.Where("id = ?", uint(id))
+		target = fmt.Sprintf("id=%d", uint(id))
+	case where["email"] != nil:
+		email, ok := where["email"].(string)
+		if !ok {
+			return nil, fmt.Errorf("email 必须是字符串")
+		}
+		query = db.Where("email = ?", strings.TrimSpace(email))
+		target = "email=" + strings.TrimSpace(email)
+	default:
+		return nil, fmt.Errorf(`where_conditions 必须且只能指定 id 或 email 之一，如 {"id":1} 或 {"email":"a@example.com"}`)
+	}
+
+	if err := query.Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("用户 %s 不存在", target)
+		}
+		return nil, fmt.Errorf("查找用户失败: %v", err)
+	}
+	return &user, nil
+}
+
+// 校验并写入 fields 中的字段，不认识的字段报错
+func applyUserFields(user *User, fields map[string]interface{}) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, ok := fields[key].(string)
+		if !containsFold(userWritableFields, key) {
+			return fmt.Errorf("不支持的字段 %s，可写入的字段: %s", key, strings.Join(userWritableFields, ", "))
+		}
+		if !ok {
+			return fmt.Errorf("字段 %s 必须是字符串", key)
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(key) {
+		case "name":
+			if value == "" {
+				return fmt.Errorf("name 不能为空")
+			}
+			if utf8.RuneCountInString(value) > maxUserNameLength {
+				return fmt.Errorf("name 不能超过 %d 个字符", maxUserNameLength)
+			}
+			user.Name = value
+		case "email":
+			if err := validateEmail(value); err != nil {
+				return err
+			}
+			user.Email = value
+		case "status":
+			if !containsFold(userStatuses, value) {
+				return fmt.Errorf("无效的状态 %q，可选值: %s", value, strings.Join(userStatuses, ", "))
+			}
+			user.Status = strings.ToLower(value)
+		}
+	}
+	return nil
+}
+
+// 只接受不带显示名的普通邮箱地址，如 a@example.com
+func validateEmail(email string) error {
+	if utf8.RuneCountInString(email) > maxUserEmailLength {
+		return fmt.Errorf("email 不能超过 %d 个字符", maxUserEmailLength)
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return fmt.Errorf("无效的邮箱地址 %q", email)
+	}
+	return nil
+}
+
+// 邮箱是否已被其他用户使用；已软删除的用户仍占用唯一索引，也要检查
+func checkEmailAvailable(db *gorm.DB, email string, exceptID uint) error {
+	var existing User
+	err := db.Unscoped().Where("email = ? AND id <> ?", email, exceptID).Take(&existing).Error
+	switch {
+	case err == nil && existing.DeletedAt.Valid:
+		return fmt.Errorf("邮箱 %s 已被已删除的用户 #%d 使用，可先 restore 恢复该用户或 purge 永久删除", email, existing.ID)
+	case err == nil:
+		return fmt.Errorf("邮箱 %s 已被用户 #%d 使用", email, existing.ID)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	default:
+		return fmt.Errorf("检查邮箱失败: %v", err)
+	}
+}
+
+// 检查之后仍可能与并发写入冲突，把唯一索引冲突转换为可读的错误
+func userWriteError(db *gorm.DB, err error, email string) error {
+	if err == nil {
+		return nil
+	}
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("邮箱 %s 已被其他用户使用", email)
+	}
+	return fmt.Errorf("保存用户失败: %v", err)
+}
+
+// 重新读取用户，作为操作结果返回
+func userResult(db *gorm.DB, operation string, id uint, rowsAffected *int64, summary string) (*QueryResult, error) {
+	columns, rows, _, err := findPage(db.Model(&User{}).Where("id = ?", id), 0, pageRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("读取用户 #%d 失败: %v", id, err)
+	}
+	result := newRowsResult(operation, "users", columns, rows, false, summary+"：")
+	result.RowsAffected = rowsAffected
+	return result, nil
+}